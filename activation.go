@@ -0,0 +1,57 @@
+//go:build unix
+
+package gotfo
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// listenFDsStart is the first descriptor passed by systemd socket
+// activation. It is a variable for tests.
+var listenFDsStart = 3
+
+// ListenFDs returns the sockets passed to the process by systemd socket
+// activation, as described by the LISTEN_PID, LISTEN_FDS and
+// LISTEN_FDNAMES environment variables. Each file is named after its
+// entry in LISTEN_FDNAMES. The sockets are marked close-on-exec and the
+// variables unset, so that they are not passed on to child processes.
+// Pass each file to FileListener to listen on it.
+//
+// ListenFDs returns no files if the variables are not set or are meant
+// for another process.
+func ListenFDs() ([]*os.File, error) {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 0 {
+		return nil, errors.New("gotfo: invalid LISTEN_FDS " + strconv.Quote(os.Getenv("LISTEN_FDS")))
+	}
+	var names []string
+	if s := os.Getenv("LISTEN_FDNAMES"); s != "" {
+		names = strings.Split(s, ":")
+	}
+
+	files := make([]*os.File, 0, n)
+	for i := 0; i < n; i++ {
+		fd := listenFDsStart + i
+		syscall.CloseOnExec(fd)
+		name := "LISTEN_FD_" + strconv.Itoa(fd)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		files = append(files, os.NewFile(uintptr(fd), name))
+	}
+	return files, nil
+}
@@ -0,0 +1,88 @@
+//go:build linux || darwin
+
+package gotfo
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+// dupListenerFD duplicates the socket of ln to the lowest descriptor
+// from min, standing in for one passed by systemd.
+func dupListenerFD(t *testing.T, ln *TFOListener, min int) int {
+	t.Helper()
+	f, err := ln.File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fd, _, e := syscall.Syscall(syscall.SYS_FCNTL, f.Fd(), syscall.F_DUPFD, uintptr(min))
+	if e != 0 {
+		t.Fatal(os.NewSyscallError("fcntl", e))
+	}
+	return int(fd)
+}
+
+func TestListenFDs(t *testing.T) {
+	defer func(fd int) { listenFDsStart = fd }(listenFDsStart)
+	listenFDsStart = 500
+
+	ln1, ln2 := newTestListener(t), newTestListener(t)
+	fd1 := dupListenerFD(t, ln1, listenFDsStart)
+	fd2 := dupListenerFD(t, ln2, listenFDsStart+1)
+	if fd1 != listenFDsStart || fd2 != listenFDsStart+1 {
+		syscall.Close(fd1)
+		syscall.Close(fd2)
+		t.Skipf("descriptors %d and %d are in use", listenFDsStart, listenFDsStart+1)
+	}
+
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "2")
+	t.Setenv("LISTEN_FDNAMES", "web:")
+	files, err := ListenFDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		defer f.Close()
+	}
+	for _, name := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+		if v, ok := os.LookupEnv(name); ok {
+			t.Errorf("%s = %q left set", name, v)
+		}
+	}
+	if len(files) != 2 {
+		t.Fatalf("%d files, want 2", len(files))
+	}
+	if got, want := files[0].Name(), "web"; got != want {
+		t.Errorf("first file named %q, want %q", got, want)
+	}
+	if got, want := files[1].Name(), "LISTEN_FD_"+strconv.Itoa(fd2); got != want {
+		t.Errorf("second file named %q, want %q", got, want)
+	}
+
+	l, err := FileListener(files[1], false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if l.Addr().String() != ln2.Addr().String() {
+		t.Fatalf("listener on %v, want %v", l.Addr(), ln2.Addr())
+	}
+}
+
+func TestListenFDsOtherProcess(t *testing.T) {
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	t.Setenv("LISTEN_FDS", "1")
+	files, err := ListenFDs()
+	if err != nil || files != nil {
+		t.Fatalf("ListenFDs = %v, %v, want no files", files, err)
+	}
+	for _, name := range []string{"LISTEN_PID", "LISTEN_FDS"} {
+		if v, ok := os.LookupEnv(name); ok {
+			t.Errorf("%s = %q left set", name, v)
+		}
+	}
+}
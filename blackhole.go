@@ -0,0 +1,230 @@
+package gotfo
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"os"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultBlackholeThreshold = 3
+	defaultBlackholeCoolDown  = 10 * time.Minute
+)
+
+// DefaultBlackholeCache is the BlackholeCache used by Dialers that do
+// not set one.
+var DefaultBlackholeCache = &BlackholeCache{}
+
+// A BlackholeCache turns Fast Open off for destinations where dials
+// that send data in the SYN keep timing out or being refused, as
+// happens behind middleboxes that drop such SYNs or answer them with a
+// reset. A refusal only counts if a dial to the destination without
+// data in the SYN has connected within CoolDown, since otherwise
+// nothing may be listening there at all. On Linux, a dial also fails
+// if it completes only after the kernel gave up on the data and sent a
+// plain SYN instead, or if the peer did not acknowledge the data, as
+// read from TCP_INFO. It works like the kernel's global Fast Open
+// blackhole detection, but for each destination address and port on
+// its own.
+//
+// Once a destination has seen Threshold failures in a row, dials to it
+// use a regular connect for CoolDown. The first dial after that probes
+// Fast Open again: if it fails too, Fast Open is turned off for another
+// CoolDown, and if it succeeds, the destination is forgotten.
+//
+// The zero value is ready to use. A BlackholeCache is safe for
+// concurrent use.
+type BlackholeCache struct {
+	// Threshold is how many failures in a row turn Fast Open off for
+	// a destination. If zero, 3 is used. If negative, Fast Open is
+	// never turned off.
+	Threshold int
+
+	// CoolDown is how long Fast Open stays off. If zero, 10 minutes
+	// is used.
+	CoolDown time.Duration
+
+	mu sync.Mutex
+	m  map[netip.AddrPort]*blackholeEntry
+}
+
+// maxBlackholeEntries bounds how many destinations a BlackholeCache
+// keeps only for a plain connect to them, as most never see a failed
+// Fast Open dial.
+const maxBlackholeEntries = 4096
+
+type blackholeEntry struct {
+	failures      int
+	disabledUntil time.Time
+
+	// connected is when a dial without data in the SYN last
+	// connected.
+	connected time.Time
+}
+
+// BlackholeEntry is the state of a destination in a BlackholeCache.
+type BlackholeEntry struct {
+	// Addr is the destination address and port.
+	Addr netip.AddrPort
+
+	// Failures is how many Fast Open dials in a row have failed.
+	Failures int
+
+	// DisabledUntil is when Fast Open comes back on for Addr, or the
+	// zero time if it was never turned off. It may be in the past,
+	// in which case the next dial probes Fast Open.
+	DisabledUntil time.Time
+}
+
+func (bc *BlackholeCache) threshold() int {
+	if bc.Threshold == 0 {
+		return defaultBlackholeThreshold
+	}
+	return bc.Threshold
+}
+
+func (bc *BlackholeCache) coolDown() time.Duration {
+	if bc.CoolDown > 0 {
+		return bc.CoolDown
+	}
+	return defaultBlackholeCoolDown
+}
+
+func blackholeKey(addr *net.TCPAddr) netip.AddrPort {
+	ap := addr.AddrPort()
+	return netip.AddrPortFrom(ap.Addr().Unmap(), ap.Port())
+}
+
+// disabled reports whether Fast Open is off for addr.
+func (bc *BlackholeCache) disabled(addr *net.TCPAddr) bool {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	e := bc.m[blackholeKey(addr)]
+	return e != nil && time.Now().Before(e.disabledUntil)
+}
+
+// errSynDataLost is reported for a dial that completed, but without
+// the peer acknowledging the data in its SYN.
+var errSynDataLost = errors.New("gotfo: data in the SYN was not acknowledged")
+
+// report records the outcome of a dial to addr that sent data in the
+// SYN. Timeouts, from the dial deadline or the kernel, and
+// errSynDataLost count as failures, and a success forgets addr. A reset
+// in answer to the SYN, which connect reports as ECONNREFUSED, counts
+// only if a plain connect to addr has succeeded within CoolDown. Other
+// errors say nothing about the path to addr.
+func (bc *BlackholeCache) report(addr *net.TCPAddr, err error) {
+	if bc.threshold() < 0 {
+		return
+	}
+	key := blackholeKey(addr)
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	if err == nil {
+		delete(bc.m, key)
+		return
+	}
+	e := bc.m[key]
+	switch {
+	case errors.Is(err, os.ErrDeadlineExceeded),
+		errors.Is(err, syscall.ETIMEDOUT),
+		errors.Is(err, errSynDataLost):
+	case errors.Is(err, syscall.ECONNREFUSED):
+		if e == nil || time.Since(e.connected) >= bc.coolDown() {
+			return
+		}
+	default:
+		return
+	}
+	if e == nil {
+		e = bc.newEntryLocked(key)
+	}
+	e.failures++
+	if e.failures >= bc.threshold() {
+		e.disabledUntil = time.Now().Add(bc.coolDown())
+	}
+}
+
+// reportPlain records that a dial to addr without data in the SYN
+// connected, showing that something listens there.
+func (bc *BlackholeCache) reportPlain(addr *net.TCPAddr) {
+	if bc.threshold() < 0 {
+		return
+	}
+	key := blackholeKey(addr)
+	now := time.Now()
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	e := bc.m[key]
+	if e == nil {
+		if len(bc.m) >= maxBlackholeEntries {
+			bc.pruneLocked(now)
+			if len(bc.m) >= maxBlackholeEntries {
+				return
+			}
+		}
+		e = bc.newEntryLocked(key)
+	}
+	e.connected = now
+}
+
+func (bc *BlackholeCache) newEntryLocked(key netip.AddrPort) *blackholeEntry {
+	if bc.m == nil {
+		bc.m = make(map[netip.AddrPort]*blackholeEntry)
+	}
+	e := &blackholeEntry{}
+	bc.m[key] = e
+	return e
+}
+
+// pruneLocked forgets the destinations with no failures whose last
+// plain connect is too old to make a refusal count.
+func (bc *BlackholeCache) pruneLocked(now time.Time) {
+	for key, e := range bc.m {
+		if e.failures == 0 && now.Sub(e.connected) >= bc.coolDown() {
+			delete(bc.m, key)
+		}
+	}
+}
+
+// Entries returns the destinations with failed Fast Open dials, sorted
+// by address.
+func (bc *BlackholeCache) Entries() []BlackholeEntry {
+	bc.mu.Lock()
+	entries := make([]BlackholeEntry, 0, len(bc.m))
+	for addr, e := range bc.m {
+		if e.failures == 0 {
+			continue
+		}
+		entries = append(entries, BlackholeEntry{
+			Addr:          addr,
+			Failures:      e.failures,
+			DisabledUntil: e.disabledUntil,
+		})
+	}
+	bc.mu.Unlock()
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Addr.Compare(entries[j].Addr) < 0
+	})
+	return entries
+}
+
+// Forget clears the state of addr, turning Fast Open back on for it.
+func (bc *BlackholeCache) Forget(addr netip.AddrPort) {
+	addr = netip.AddrPortFrom(addr.Addr().Unmap(), addr.Port())
+	bc.mu.Lock()
+	delete(bc.m, addr)
+	bc.mu.Unlock()
+}
+
+// Reset clears the state of every destination.
+func (bc *BlackholeCache) Reset() {
+	bc.mu.Lock()
+	bc.m = nil
+	bc.mu.Unlock()
+}
@@ -0,0 +1,264 @@
+package gotfo
+
+import (
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestBlackholeCacheReport(t *testing.T) {
+	addr := &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 443}
+	dialErr := func(err error) error {
+		return &net.OpError{Op: "dial", Net: "tcp", Addr: addr, Err: err}
+	}
+
+	tests := []struct {
+		name   string
+		err    error
+		counts bool
+	}{
+		{"deadline", dialErr(errTimeout), true},
+		{"kernel timeout", dialErr(os.NewSyscallError("connect", syscall.ETIMEDOUT)), true},
+		{"syn data lost", errSynDataLost, true},
+		{"refused", dialErr(os.NewSyscallError("connect", syscall.ECONNREFUSED)), false},
+		{"canceled", dialErr(errCanceled), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc := &BlackholeCache{Threshold: 2}
+			bc.report(addr, tt.err)
+			bc.report(addr, tt.err)
+			if got := bc.disabled(addr); got != tt.counts {
+				t.Fatalf("disabled after two reports = %v, want %v", got, tt.counts)
+			}
+		})
+	}
+}
+
+// TestBlackholeCacheRefused checks that a refused dial counts as a
+// failure only after a plain connect to the destination.
+func TestBlackholeCacheRefused(t *testing.T) {
+	addr := &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 443}
+	refused := &net.OpError{Op: "dial", Net: "tcp", Addr: addr, Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+	bc := &BlackholeCache{Threshold: 2}
+
+	bc.reportPlain(addr)
+	if n := len(bc.Entries()); n != 0 {
+		t.Fatalf("%d entries after a plain connect, want none", n)
+	}
+	bc.report(addr, refused)
+	bc.report(addr, refused)
+	if !bc.disabled(addr) {
+		t.Fatal("refusals after a plain connect did not turn Fast Open off")
+	}
+
+	// A plain connect too long ago says nothing.
+	bc.Reset()
+	bc.reportPlain(addr)
+	bc.m[blackholeKey(addr)].connected = time.Now().Add(-bc.coolDown())
+	bc.report(addr, refused)
+	bc.report(addr, refused)
+	if bc.disabled(addr) {
+		t.Fatal("refusals long after a plain connect turned Fast Open off")
+	}
+}
+
+func TestBlackholeCacheSuccessForgets(t *testing.T) {
+	addr := &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 443}
+	bc := &BlackholeCache{Threshold: 2}
+	bc.report(addr, errSynDataLost)
+	bc.report(addr, nil)
+	bc.report(addr, errSynDataLost)
+	if bc.disabled(addr) {
+		t.Fatal("failures were not reset by a success")
+	}
+	if n := len(bc.Entries()); n != 1 {
+		t.Fatalf("%d entries, want 1", n)
+	}
+
+	bc.report(addr, errSynDataLost)
+	e := bc.Entries()[0]
+	if e.Failures != 2 || !e.DisabledUntil.After(time.Now()) {
+		t.Fatalf("entry = %+v, want 2 failures and Fast Open off", e)
+	}
+}
+
+func TestBlackholeCacheDisabled(t *testing.T) {
+	addr := &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 443}
+	bc := &BlackholeCache{Threshold: -1}
+	for range 10 {
+		bc.report(addr, errSynDataLost)
+	}
+	if bc.disabled(addr) || len(bc.Entries()) != 0 {
+		t.Fatal("a negative Threshold recorded failures")
+	}
+}
+
+// TestBlackholeCacheAckedSynData dials a Fast Open listener twice over
+// loopback: the second dial has a cookie and sends its data in the SYN,
+// which the listener acknowledges, so it must not count as a failure.
+func TestBlackholeCacheAckedSynData(t *testing.T) {
+	if !serverFastOpenEnabled() {
+		t.Skip("Fast Open is not enabled for both clients and servers")
+	}
+	ln, err := Listen("127.0.0.1:0", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go serveEcho(ln)
+
+	bc := &BlackholeCache{Threshold: 1}
+	d := &Dialer{FastOpen: true, BlackholeCache: bc, Timeout: 5 * time.Second}
+	for i := range 2 {
+		c, err := d.DialContext(WithData(t.Context(), []byte("hello")), "tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, err := FastOpenStatus(c)
+		c.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 1 && (info.SynBytes == 0 || !info.SynDataAcked) {
+			t.Fatalf("second dial: %+v, want acknowledged data in the SYN", info)
+		}
+	}
+	if entries := bc.Entries(); len(entries) != 0 {
+		t.Fatalf("entries = %+v, want none", entries)
+	}
+}
+
+// TestBlackholeCacheUnackedSynData dials a listener without Fast Open
+// with a cookie cached for its address, so the data in the SYN is not
+// acknowledged, which must count as a failure even though the dial
+// completes.
+func TestBlackholeCacheUnackedSynData(t *testing.T) {
+	if !serverFastOpenEnabled() {
+		t.Skip("Fast Open is not enabled for both clients and servers")
+	}
+	serve := func(fastOpen bool) net.Listener {
+		ln, err := Listen("127.0.0.1:0", fastOpen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { ln.Close() })
+		go serveEcho(ln)
+		return ln
+	}
+
+	bc := &BlackholeCache{Threshold: 1}
+	d := &Dialer{FastOpen: true, BlackholeCache: bc, Timeout: 5 * time.Second}
+	dial := func(ln net.Listener) {
+		c, err := d.DialContext(WithData(t.Context(), []byte("hello")), "tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Close()
+	}
+
+	// Get a cookie for the loopback address.
+	tfo := serve(true)
+	dial(tfo)
+	dial(tfo)
+
+	plain := serve(false)
+	dial(plain)
+	addr := plain.Addr().(*net.TCPAddr)
+	if !bc.disabled(addr) {
+		t.Fatalf("entries = %+v, want Fast Open off for %v", bc.Entries(), addr)
+	}
+}
+
+// TestBlackholeCacheRefusedSynData dials ports that stopped listening
+// with data in the SYN, which the kernel answers with a reset. It counts
+// as a failure for a port a plain dial connected to just before, and not
+// for one nothing was connected to.
+func TestBlackholeCacheRefusedSynData(t *testing.T) {
+	if !serverFastOpenEnabled() {
+		t.Skip("Fast Open is not enabled for both clients and servers")
+	}
+	bc := &BlackholeCache{Threshold: 1}
+	d := &Dialer{FastOpen: true, BlackholeCache: bc, Timeout: 5 * time.Second}
+	dial := func(d *Dialer, addr string) error {
+		c, err := d.DialContext(WithData(t.Context(), []byte("hello")), "tcp", addr)
+		if err == nil {
+			c.Close()
+		}
+		return err
+	}
+	closedAddr := func(dialPlain bool) *net.TCPAddr {
+		ln, err := Listen("127.0.0.1:0", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ln.Close()
+		if dialPlain {
+			plain := *d
+			plain.FastOpen = false
+			if err := dial(&plain, ln.Addr().String()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return ln.Addr().(*net.TCPAddr)
+	}
+
+	// Get a cookie for the loopback address.
+	tfo, err := Listen("127.0.0.1:0", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tfo.Close()
+	go serveEcho(tfo)
+	for range 2 {
+		if err := dial(d, tfo.Addr().String()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, dialPlain := range []bool{false, true} {
+		addr := closedAddr(dialPlain)
+		if err := dial(d, addr.String()); !errors.Is(err, syscall.ECONNREFUSED) {
+			t.Fatalf("dial = %v, want ECONNREFUSED", err)
+		}
+		if got := bc.disabled(addr); got != dialPlain {
+			t.Fatalf("after a plain connect %v: Fast Open off = %v, want %v", dialPlain, got, dialPlain)
+		}
+	}
+}
+
+// TestBlackholeCacheFastOpenConnect checks that a FastOpenConnect dial
+// leaves TCP_FASTOPEN_CONNECT off where the BlackholeCache has turned
+// Fast Open off.
+func TestBlackholeCacheFastOpenConnect(t *testing.T) {
+	if caps, err := Capabilities(); err != nil || !caps.FastOpenConnect || !caps.Client {
+		t.Skip("TCP_FASTOPEN_CONNECT is not supported or client Fast Open is disabled")
+	}
+	ln := newTestListener(t)
+	go serveEcho(ln)
+	addr := ln.Addr().(*net.TCPAddr)
+
+	bc := &BlackholeCache{Threshold: 1}
+	d := &Dialer{FastOpenConnect: true, BlackholeCache: bc, Timeout: 5 * time.Second}
+	for _, want := range []DialPath{DialPathFastOpen, DialPathBlackholed} {
+		c, err := d.Dial("tcp", addr.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Close()
+		if got := ConnDialPath(c); got != want {
+			t.Fatalf("dial path %v, want %v", got, want)
+		}
+		bc.report(addr, errSynDataLost)
+	}
+}
+
+// serverFastOpenEnabled reports whether the system lets both dialed and
+// listening sockets use Fast Open.
+func serverFastOpenEnabled() bool {
+	caps, err := Capabilities()
+	return err == nil && caps.Client && caps.Server
+}
@@ -0,0 +1,38 @@
+package gotfo
+
+import "time"
+
+// CapabilityInfo describes the Fast Open support of the running system,
+// as returned by Capabilities.
+type CapabilityInfo struct {
+	// Sysctl is the raw value of the system's Fast Open switch:
+	// net.ipv4.tcp_fastopen on Linux and net.inet.tcp.fastopen on
+	// macOS. It is zero on Windows, which has no such switch.
+	Sysctl int
+
+	// Client and Server report whether the system lets dialed and
+	// listening sockets use Fast Open.
+	Client bool
+	Server bool
+
+	// ClientNoCookie reports that clients send data in the SYN even
+	// without a cookie, and ServerNoCookie that servers accept it
+	// without one. ServerAllListeners reports that every listener
+	// takes Fast Open without setting TCP_FASTOPEN. These are Linux
+	// only.
+	ClientNoCookie     bool
+	ServerNoCookie     bool
+	ServerAllListeners bool
+
+	// BlackholeTimeout is how long Linux turns client Fast Open off
+	// for after detecting a middlebox that drops it, from
+	// net.ipv4.tcp_fastopen_blackhole_timeout_sec. Zero means the
+	// detection is disabled.
+	BlackholeTimeout time.Duration
+
+	// FastOpenConnect and FastOpenKey report whether the
+	// TCP_FASTOPEN_CONNECT and TCP_FASTOPEN_KEY socket options are
+	// supported.
+	FastOpenConnect bool
+	FastOpenKey     bool
+}
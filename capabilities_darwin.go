@@ -0,0 +1,31 @@
+package gotfo
+
+import (
+	"os"
+	"syscall"
+)
+
+// Bits of net.inet.tcp.fastopen, as xnu defines them.
+const (
+	tfoServerEnable = 0x1
+	tfoClientEnable = 0x2
+)
+
+// Capabilities reports the Fast Open support of the running system. On
+// macOS it reads net.inet.tcp.fastopen.
+func Capabilities() (*CapabilityInfo, error) {
+	v, err := syscall.SysctlUint32("net.inet.tcp.fastopen")
+	if err != nil {
+		return nil, os.NewSyscallError("sysctl", err)
+	}
+	return sysctlCapabilities(int(v)), nil
+}
+
+// sysctlCapabilities decodes the value v of net.inet.tcp.fastopen.
+func sysctlCapabilities(v int) *CapabilityInfo {
+	return &CapabilityInfo{
+		Sysctl: v,
+		Client: v&tfoClientEnable != 0,
+		Server: v&tfoServerEnable != 0,
+	}
+}
@@ -0,0 +1,20 @@
+package gotfo
+
+import "testing"
+
+func TestSysctlCapabilities(t *testing.T) {
+	tests := []struct {
+		v    int
+		want CapabilityInfo
+	}{
+		{0, CapabilityInfo{}},
+		{1, CapabilityInfo{Sysctl: 1, Server: true}},
+		{2, CapabilityInfo{Sysctl: 2, Client: true}},
+		{3, CapabilityInfo{Sysctl: 3, Client: true, Server: true}},
+	}
+	for _, tt := range tests {
+		if got := sysctlCapabilities(tt.v); *got != tt.want {
+			t.Errorf("sysctlCapabilities(%#x) = %+v, want %+v", tt.v, *got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package gotfo
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Bits of net.ipv4.tcp_fastopen.
+const (
+	tfoClientEnable        = 0x1
+	tfoServerEnable        = 0x2
+	tfoClientNoCookie      = 0x4
+	tfoServerCookieNotReqd = 0x200
+	tfoServerWoSockopt     = 0x400
+)
+
+func readSysctlInt(name string) (int, error) {
+	b, err := os.ReadFile("/proc/sys/" + strings.ReplaceAll(name, ".", "/"))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(b)))
+}
+
+// Capabilities reports the Fast Open support of the running system. On
+// Linux it reads net.ipv4.tcp_fastopen and probes a socket for the
+// TCP_FASTOPEN_CONNECT and TCP_FASTOPEN_KEY options.
+func Capabilities() (*CapabilityInfo, error) {
+	v, err := readSysctlInt("net.ipv4.tcp_fastopen")
+	if err != nil {
+		return nil, err
+	}
+	caps := sysctlCapabilities(v)
+
+	// Added in Linux 4.11, like TCP_FASTOPEN_CONNECT.
+	if sec, err := readSysctlInt("net.ipv4.tcp_fastopen_blackhole_timeout_sec"); err == nil {
+		caps.BlackholeTimeout = time.Duration(sec) * time.Second
+	}
+
+	fd, err := socket(syscall.AF_INET, false, false)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.Close(fd)
+	if caps.FastOpenConnect, err = hasSockopt(fd, TCP_FASTOPEN_CONNECT); err != nil {
+		return nil, err
+	}
+	if caps.FastOpenKey, err = hasSockopt(fd, TCP_FASTOPEN_KEY); err != nil {
+		return nil, err
+	}
+	return caps, nil
+}
+
+// sysctlCapabilities decodes the value v of net.ipv4.tcp_fastopen.
+func sysctlCapabilities(v int) *CapabilityInfo {
+	return &CapabilityInfo{
+		Sysctl:             v,
+		Client:             v&tfoClientEnable != 0,
+		Server:             v&tfoServerEnable != 0,
+		ClientNoCookie:     v&tfoClientNoCookie != 0,
+		ServerNoCookie:     v&tfoServerCookieNotReqd != 0,
+		ServerAllListeners: v&tfoServerWoSockopt != 0,
+	}
+}
+
+// hasSockopt reports whether the kernel knows the TCP level socket
+// option opt.
+func hasSockopt(fd, opt int) (bool, error) {
+	_, err := syscall.GetsockoptInt(fd, syscall.SOL_TCP, opt)
+	switch err {
+	case nil:
+		return true, nil
+	case syscall.ENOPROTOOPT:
+		return false, nil
+	}
+	return false, os.NewSyscallError("getsockopt", err)
+}
@@ -0,0 +1,22 @@
+package gotfo
+
+import "testing"
+
+func TestSysctlCapabilities(t *testing.T) {
+	tests := []struct {
+		v    int
+		want CapabilityInfo
+	}{
+		{0, CapabilityInfo{}},
+		{1, CapabilityInfo{Sysctl: 1, Client: true}},
+		{2, CapabilityInfo{Sysctl: 2, Server: true}},
+		{3, CapabilityInfo{Sysctl: 3, Client: true, Server: true}},
+		{0x5, CapabilityInfo{Sysctl: 0x5, Client: true, ClientNoCookie: true}},
+		{0x602, CapabilityInfo{Sysctl: 0x602, Server: true, ServerNoCookie: true, ServerAllListeners: true}},
+	}
+	for _, tt := range tests {
+		if got := sysctlCapabilities(tt.v); *got != tt.want {
+			t.Errorf("sysctlCapabilities(%#x) = %+v, want %+v", tt.v, *got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !darwin && !linux && !windows
+
+package gotfo
+
+// Capabilities reports the Fast Open support of the running system,
+// which is none on this platform.
+func Capabilities() (*CapabilityInfo, error) {
+	return nil, errUnsupported
+}
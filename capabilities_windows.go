@@ -0,0 +1,21 @@
+package gotfo
+
+import (
+	"os"
+	"syscall"
+)
+
+// Capabilities reports the Fast Open support of the running system. On
+// Windows, which has no system-wide switch, it checks that a socket
+// takes the TCP_FASTOPEN option, as it does since Windows 10 version
+// 1607, for Server. Client is always false, as dials never send data
+// in the SYN; see Dialer.FastOpen.
+func Capabilities() (*CapabilityInfo, error) {
+	s, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM, syscall.IPPROTO_TCP)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	defer syscall.Closesocket(s)
+	ok := syscall.SetsockoptInt(s, syscall.IPPROTO_TCP, TCP_FASTOPEN, 1) == nil
+	return &CapabilityInfo{Server: ok}, nil
+}
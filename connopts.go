@@ -0,0 +1,66 @@
+package gotfo
+
+import (
+	"net"
+	"time"
+)
+
+// defaultTCPKeepAlive is the keep-alive period used when KeepAlive is
+// zero, matching the net package.
+const defaultTCPKeepAlive = 15 * time.Second
+
+// connOptions are the socket options that a Dialer or ListenConfig sets
+// on each of its connections.
+type connOptions struct {
+	keepAlive       time.Duration
+	keepAliveConfig net.KeepAliveConfig
+	userTimeout     time.Duration
+	nagle           bool
+}
+
+// check fails if the platform cannot set the options, so that a Dialer
+// or ListenConfig with them fails at once rather than on every
+// connection.
+func (o connOptions) check() error {
+	if o.userTimeout != 0 {
+		return checkUserTimeout()
+	}
+	return nil
+}
+
+// apply sets the options on c. Like the net package, it ignores errors
+// from the keep-alive and TCP_NODELAY options, which are always
+// supported.
+func (o connOptions) apply(c *net.TCPConn) error {
+	// net.FileConn turns keep-alives on by default, so they are
+	// switched off explicitly as well.
+	cfg := o.keepAliveConfig
+	switch {
+	case cfg.Enable:
+	case o.keepAlive < 0:
+		c.SetKeepAlive(false)
+	default:
+		cfg = net.KeepAliveConfig{Enable: true, Idle: o.keepAlive, Interval: cfg.Interval, Count: cfg.Count}
+	}
+	if cfg.Enable {
+		if cfg.Idle == 0 {
+			cfg.Idle = defaultTCPKeepAlive
+		}
+		c.SetKeepAliveConfig(cfg)
+	}
+
+	if o.nagle {
+		c.SetNoDelay(false)
+	}
+
+	if o.userTimeout != 0 {
+		rc, err := c.SyscallConn()
+		if err != nil {
+			return err
+		}
+		if err := setUserTimeout(rc, o.userTimeout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package gotfo
+
+import (
+	"context"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func getsockoptInt(t *testing.T, c net.Conn, level, opt int) int {
+	t.Helper()
+	rc, err := c.(syscall.Conn).SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v int
+	err = controlErr(rc, func(fd int) (err error) {
+		v, err = syscall.GetsockoptInt(fd, level, opt)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+// TestConnOptions reads back the options a Dialer and a ListenConfig set
+// on their connections.
+func TestConnOptions(t *testing.T) {
+	lc := &ListenConfig{
+		KeepAliveConfig: net.KeepAliveConfig{Enable: true, Idle: 42 * time.Second},
+		UserTimeout:     7 * time.Second,
+		Nagle:           true,
+	}
+	ln, err := lc.Listen(context.Background(), "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	d := &Dialer{
+		KeepAliveConfig: net.KeepAliveConfig{Enable: true, Idle: 43 * time.Second},
+		UserTimeout:     8 * time.Second,
+	}
+	c, err := d.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	sc, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sc.Close()
+
+	tests := []struct {
+		name       string
+		c          net.Conn
+		level, opt int
+		want       int
+	}{
+		{"dialed TCP_KEEPIDLE", c, syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE, 43},
+		{"dialed TCP_USER_TIMEOUT", c, syscall.IPPROTO_TCP, tcpUserTimeout, 8000},
+		{"dialed TCP_NODELAY", c, syscall.IPPROTO_TCP, syscall.TCP_NODELAY, 1},
+		{"accepted TCP_KEEPIDLE", sc, syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE, 42},
+		{"accepted TCP_USER_TIMEOUT", sc, syscall.IPPROTO_TCP, tcpUserTimeout, 7000},
+		{"accepted TCP_NODELAY", sc, syscall.IPPROTO_TCP, syscall.TCP_NODELAY, 0},
+	}
+	for _, tt := range tests {
+		if got := getsockoptInt(t, tt.c, tt.level, tt.opt); got != tt.want {
+			t.Errorf("%s = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	// A negative KeepAlive turns keep-alives off.
+	d = &Dialer{KeepAlive: -1}
+	c2, err := d.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c2.Close()
+	if got := getsockoptInt(t, c2, syscall.SOL_SOCKET, syscall.SO_KEEPALIVE); got != 0 {
+		t.Errorf("SO_KEEPALIVE = %d with a negative KeepAlive, want 0", got)
+	}
+}
@@ -0,0 +1,30 @@
+//go:build !linux
+
+package gotfo
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestUserTimeoutUnsupported checks that UserTimeout fails the dial or
+// listen, rather than every connection, where it is not supported.
+func TestUserTimeoutUnsupported(t *testing.T) {
+	lc := &ListenConfig{UserTimeout: time.Second}
+	if ln, err := lc.Listen(context.Background(), "tcp", "127.0.0.1:0"); !errors.Is(err, syscall.ENOPROTOOPT) {
+		if err == nil {
+			ln.Close()
+		}
+		t.Fatalf("Listen = %v, want ENOPROTOOPT", err)
+	}
+	d := &Dialer{UserTimeout: time.Second}
+	if c, err := d.Dial("tcp", "127.0.0.1:1"); !errors.Is(err, syscall.ENOPROTOOPT) {
+		if err == nil {
+			c.Close()
+		}
+		t.Fatalf("Dial = %v, want ENOPROTOOPT", err)
+	}
+}
@@ -0,0 +1,311 @@
+package gotfo
+
+import (
+	"context"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// deferredConn is a connection from a Dialer with DeferConnect set. Its
+// socket is connected by the first Write, which sends its data with the
+// SYN, or by the first Read if that comes before any Write.
+type deferredConn struct {
+	d            *Dialer
+	sock         *dialSocket
+	network      string
+	laddr, raddr *net.TCPAddr
+	data         []byte
+	// fellBack is set when the socket was created without Fast Open
+	// after the system refused it.
+	fellBack bool
+
+	// done is closed once the connect has finished or will never
+	// happen. conn and err do not change after that.
+	done chan struct{}
+	conn *net.TCPConn
+	err  error
+
+	mu            sync.Mutex
+	started       bool
+	closed        bool
+	cancel        context.CancelFunc
+	readDeadline  time.Time
+	writeDeadline time.Time
+	// deadlineChanged is closed and replaced whenever a deadline is
+	// set before the connect finishes, waking up calls waiting for
+	// it.
+	deadlineChanged chan struct{}
+}
+
+func (d *Dialer) dialDeferred(ctx context.Context, network string, laddr, raddr *net.TCPAddr, data []byte) (net.Conn, error) {
+	dd := *d
+	s, err := dd.newDialSocket(ctx, network, laddr, raddr)
+	fellBack := false
+	if err != nil && dd.canFallBack(err) {
+		dd = *dd.withoutFastOpen()
+		s, err = dd.newDialSocket(ctx, network, laddr, raddr)
+		fellBack = true
+	}
+	if err != nil {
+		return nil, dd.dialError(network, laddr, raddr, err)
+	}
+	return &deferredConn{
+		d:               &dd,
+		sock:            s,
+		network:         network,
+		laddr:           laddr,
+		raddr:           raddr,
+		data:            data,
+		fellBack:        fellBack,
+		done:            make(chan struct{}),
+		deadlineChanged: make(chan struct{}),
+	}, nil
+}
+
+// connect connects the socket, sending the dial data followed by b, unless
+// another call has started the connect already. It reports whether this
+// call started it, and the error from it if so.
+//
+// The connect gives up at the Dialer's Timeout or Deadline, or at the
+// read or write deadline of the call, whichever comes first.
+func (c *deferredConn) connect(b []byte, write bool) (bool, error) {
+	c.mu.Lock()
+	if c.started {
+		c.mu.Unlock()
+		return false, nil
+	}
+	deadline := c.readDeadline
+	if write {
+		deadline = c.writeDeadline
+	}
+	if !deadline.IsZero() && !deadline.After(time.Now()) {
+		// Time out like an ordinary conn would, leaving the
+		// connect to a later call with a new deadline.
+		c.mu.Unlock()
+		return true, os.ErrDeadlineExceeded
+	}
+	c.started = true
+	deadline = minNonzeroTime(deadline, c.d.deadline(context.Background(), time.Now()))
+	ctx, cancel := context.WithCancel(context.Background())
+	if !deadline.IsZero() {
+		ctx, cancel = context.WithDeadline(context.Background(), deadline)
+	}
+	c.cancel = cancel
+	c.mu.Unlock()
+	defer cancel()
+
+	data := c.data
+	if len(b) > 0 {
+		data = append(data[:len(data):len(data)], b...)
+	}
+	conn, err := c.d.connect(ctx, c.sock, c.network, c.laddr, c.raddr, data)
+	if err == nil {
+		if c.fellBack {
+			recordDialPath(conn, DialPathFallback)
+		}
+		if err = c.d.connOptions().apply(conn); err != nil {
+			conn.Close()
+			conn = nil
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		if conn != nil {
+			conn.Close()
+			conn = nil
+		}
+		err = net.ErrClosed
+	}
+	if conn != nil {
+		conn.SetReadDeadline(c.readDeadline)
+		conn.SetWriteDeadline(c.writeDeadline)
+	}
+	c.conn, c.err = conn, err
+	close(c.done)
+	return true, err
+}
+
+// wait waits for the connect started by another call to finish, giving
+// up at the read or write deadline.
+func (c *deferredConn) wait(write bool) error {
+	for {
+		c.mu.Lock()
+		deadline := c.readDeadline
+		if write {
+			deadline = c.writeDeadline
+		}
+		changed := c.deadlineChanged
+		c.mu.Unlock()
+
+		var timeout <-chan time.Time
+		var t *time.Timer
+		if !deadline.IsZero() {
+			t = time.NewTimer(time.Until(deadline))
+			timeout = t.C
+		}
+		select {
+		case <-c.done:
+		case <-timeout:
+		case <-changed:
+		}
+		if t != nil {
+			t.Stop()
+		}
+
+		select {
+		case <-c.done:
+			return c.err
+		case <-changed:
+			continue
+		default:
+			return os.ErrDeadlineExceeded
+		}
+	}
+}
+
+// Read reads data from the connection, connecting first if nothing has
+// been written yet.
+func (c *deferredConn) Read(b []byte) (int, error) {
+	started, err := c.connect(nil, false)
+	if !started {
+		err = c.wait(false)
+	}
+	if err != nil {
+		return 0, c.opError("read", err)
+	}
+	return c.conn.Read(b)
+}
+
+// Write writes data to the connection. The first Write connects, sending
+// b in the SYN when the Dialer has FastOpen set.
+func (c *deferredConn) Write(b []byte) (int, error) {
+	started, err := c.connect(b, true)
+	if started {
+		if err != nil {
+			return 0, c.opError("write", err)
+		}
+		return len(b), nil
+	}
+	if err := c.wait(true); err != nil {
+		return 0, c.opError("write", err)
+	}
+	return c.conn.Write(b)
+}
+
+// Close closes the connection, aborting a connect in progress.
+func (c *deferredConn) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return c.opError("close", net.ErrClosed)
+	}
+	c.closed = true
+	switch {
+	case !c.started:
+		c.started = true
+		c.err = net.ErrClosed
+		close(c.done)
+		c.mu.Unlock()
+		return c.sock.close()
+	case c.conn != nil:
+		c.mu.Unlock()
+		return c.conn.Close()
+	default:
+		// connect sees closed once it returns.
+		c.cancel()
+		c.mu.Unlock()
+		return nil
+	}
+}
+
+// LocalAddr returns the local network address. Before the connect it is
+// Dialer.LocalAddr, or the unspecified address if that was not set.
+func (c *deferredConn) LocalAddr() net.Addr {
+	if conn := c.connected(); conn != nil {
+		return conn.LocalAddr()
+	}
+	if c.laddr != nil {
+		return c.laddr
+	}
+	return &net.TCPAddr{}
+}
+
+// RemoteAddr returns the remote network address.
+func (c *deferredConn) RemoteAddr() net.Addr {
+	return c.raddr
+}
+
+// SetDeadline sets the read and write deadlines. Deadlines set before
+// the connect also bound the connect.
+func (c *deferredConn) SetDeadline(t time.Time) error {
+	return c.setDeadline(t, true, true)
+}
+
+// SetReadDeadline sets the read deadline.
+func (c *deferredConn) SetReadDeadline(t time.Time) error {
+	return c.setDeadline(t, true, false)
+}
+
+// SetWriteDeadline sets the write deadline.
+func (c *deferredConn) SetWriteDeadline(t time.Time) error {
+	return c.setDeadline(t, false, true)
+}
+
+func (c *deferredConn) setDeadline(t time.Time, read, write bool) error {
+	c.mu.Lock()
+	if conn := c.conn; conn != nil {
+		c.mu.Unlock()
+		switch {
+		case read && write:
+			return conn.SetDeadline(t)
+		case read:
+			return conn.SetReadDeadline(t)
+		default:
+			return conn.SetWriteDeadline(t)
+		}
+	}
+	defer c.mu.Unlock()
+	if c.closed {
+		return c.opError("set", net.ErrClosed)
+	}
+	if read {
+		c.readDeadline = t
+	}
+	if write {
+		c.writeDeadline = t
+	}
+	close(c.deadlineChanged)
+	c.deadlineChanged = make(chan struct{})
+	return nil
+}
+
+// SyscallConn returns a raw network connection once connected.
+func (c *deferredConn) SyscallConn() (syscall.RawConn, error) {
+	conn := c.connected()
+	if conn == nil {
+		return nil, syscall.ENOTCONN
+	}
+	return conn.SyscallConn()
+}
+
+// opError wraps err from operation op in a *net.OpError, unless it is
+// one already, as from a failed connect.
+func (c *deferredConn) opError(op string, err error) error {
+	return opError(op, c.network, c.laddr, c.raddr, err)
+}
+
+// connected returns the connected *net.TCPConn, or nil if there is none
+// yet.
+func (c *deferredConn) connected() *net.TCPConn {
+	select {
+	case <-c.done:
+		return c.conn
+	default:
+		return nil
+	}
+}
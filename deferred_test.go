@@ -0,0 +1,154 @@
+package gotfo
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDeferConnectWrite(t *testing.T) {
+	ln := newTestListener(t)
+
+	d := &Dialer{FastOpen: true, DeferConnect: true, Timeout: 5 * time.Second}
+	c, err := d.DialContext(WithData(context.Background(), []byte("hi ")), "tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// Nothing is sent before the first Write.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if sc, err := ln.AcceptContext(ctx); err == nil {
+		sc.Close()
+		t.Fatal("connection accepted before the first Write")
+	}
+
+	go serveEcho(ln)
+	if _, err := c.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 8)
+	if _, err := io.ReadFull(c, b); err != nil || string(b) != "hi hello" {
+		t.Fatalf("read %q, %v, want the dial data and the first Write echoed", b, err)
+	}
+	want := DialPathFastOpen
+	if !clientFastOpen {
+		want = DialPathRegular
+	}
+	if p := ConnDialPath(c); p != want {
+		t.Fatalf("ConnDialPath = %v, want %v", p, want)
+	}
+}
+
+// TestDeferConnectConcurrentReadWrite starts the first Read and the
+// first Write at once, so either may connect. The data must go out
+// once, in order, whichever does.
+func TestDeferConnectConcurrentReadWrite(t *testing.T) {
+	ln := newTestListener(t)
+	go serveEcho(ln)
+
+	d := &Dialer{FastOpen: true, DeferConnect: true, Timeout: 5 * time.Second}
+	for range 50 {
+		c, err := d.DialContext(WithData(context.Background(), []byte("hi ")), "tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var wg sync.WaitGroup
+		var readErr, writeErr error
+		b := make([]byte, 8)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, readErr = io.ReadFull(c, b)
+		}()
+		go func() {
+			defer wg.Done()
+			_, writeErr = c.Write([]byte("hello"))
+		}()
+		wg.Wait()
+		c.Close()
+
+		if writeErr != nil {
+			t.Fatalf("Write = %v", writeErr)
+		}
+		if readErr != nil || string(b) != "hi hello" {
+			t.Fatalf("read %q, %v, want %q", b, readErr, "hi hello")
+		}
+	}
+}
+
+func TestDeferConnectClose(t *testing.T) {
+	ln := newTestListener(t)
+
+	d := &Dialer{DeferConnect: true}
+	c, err := d.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Write([]byte("hello")); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("Write after Close = %v, want net.ErrClosed", err)
+	}
+	if _, err := c.Read(make([]byte, 1)); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("Read after Close = %v, want net.ErrClosed", err)
+	}
+	if err := c.Close(); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("second Close = %v, want net.ErrClosed", err)
+	}
+}
+
+// TestDeferConnectCloseDuringConnect closes the connection while the
+// first Read waits for a connect that hangs.
+func TestDeferConnectCloseDuringConnect(t *testing.T) {
+	ln := newHangingListener(t, "tcp4", "127.0.0.1:0")
+
+	d := &Dialer{DeferConnect: true}
+	c, err := d.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.AfterFunc(50*time.Millisecond, func() { c.Close() })
+	start := time.Now()
+	if _, err := c.Read(make([]byte, 1)); err == nil {
+		t.Fatal("Read succeeded on a closed connection")
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Fatalf("Read took %v to return after Close", d)
+	}
+}
+
+func TestDeferConnectDeadline(t *testing.T) {
+	ln := newTestListener(t)
+	go serveEcho(ln)
+
+	d := &Dialer{DeferConnect: true, Timeout: 5 * time.Second}
+	c, err := d.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// A Read past its deadline times out without connecting, and a
+	// later Write still connects.
+	c.SetReadDeadline(time.Now().Add(-time.Second))
+	if _, err := c.Read(make([]byte, 1)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Read = %v, want os.ErrDeadlineExceeded", err)
+	}
+	c.SetReadDeadline(noDeadline)
+	if _, err := c.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 5)
+	if _, err := io.ReadFull(c, b); err != nil || string(b) != "hello" {
+		t.Fatalf("read %q, %v, want %q", b, err, "hello")
+	}
+}
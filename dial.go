@@ -0,0 +1,641 @@
+package gotfo
+
+import (
+	"context"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// A Dialer contains options for connecting to an address. It mirrors
+// net.Dialer, so that its DialContext method can be used anywhere a
+// dial function is expected, such as http.Transport.DialContext.
+//
+// The zero value for each field is equivalent to dialing without that
+// option.
+type Dialer struct {
+	// Timeout is the maximum amount of time a dial will wait for
+	// a connect to complete. If Deadline is also set, it may fail
+	// earlier.
+	Timeout time.Duration
+
+	// Deadline is the absolute point in time after which dials
+	// will fail. If Timeout is set, it may fail earlier.
+	Deadline time.Time
+
+	// LocalAddr is the local address to use when dialing an
+	// address. It must be a *net.TCPAddr. The socket is bound to it
+	// before the SYN is sent, and only addresses of its family are
+	// dialed. With port zero, Linux picks the port at connect time,
+	// so that dials from one address to many destinations do not
+	// run out of ephemeral ports. If nil, a local address is
+	// automatically chosen.
+	LocalAddr net.Addr
+
+	// KeepAlive specifies the interval between keep-alive probes.
+	// If zero, keep-alives are enabled with a default period of 15
+	// seconds. If negative, keep-alives are disabled.
+	KeepAlive time.Duration
+
+	// KeepAliveConfig specifies the keep-alive probe configuration,
+	// as for net.Dialer. If KeepAliveConfig.Enable is true,
+	// keep-alive probes are enabled. If KeepAliveConfig.Enable is
+	// false and KeepAlive is negative, they are disabled.
+	KeepAliveConfig net.KeepAliveConfig
+
+	// UserTimeout is how long sent data may remain unacknowledged
+	// before the connection is dropped, the TCP_USER_TIMEOUT socket
+	// option. It is only supported on Linux, and elsewhere dials
+	// with it fail. If zero, the system default is kept.
+	UserTimeout time.Duration
+
+	// Nagle leaves Nagle's algorithm on, so that small writes are
+	// coalesced. By default, as in the net package, TCP_NODELAY is
+	// set.
+	Nagle bool
+
+	// FastOpen sends the data attached to the dial context with
+	// WithData in the SYN.
+	//
+	// On Windows, the data is sent after the handshake instead: the
+	// net package connects with ConnectEx but without a payload, and
+	// a *net.TCPConn cannot be made from a socket connected any other
+	// way. Such dials report DialPathRegular, and Capabilities
+	// reports no client support.
+	FastOpen bool
+
+	// FastOpenConnect dials with the TCP_FASTOPEN_CONNECT socket
+	// option, supported on Linux 4.11 and later. When the kernel has
+	// a cookie for the peer, the dial returns without sending
+	// anything, and the SYN goes out with the first Write, carrying
+	// its data. Any net.Conn consumer thus gets Fast Open without
+	// knowing the data at dial time. The connection must be written
+	// to before it is read from, or the Read waits for a SYN that is
+	// never sent. Without a cookie the dial completes a regular
+	// handshake that asks for one.
+	//
+	// The connection returned is not a *net.TCPConn, as its
+	// RemoteAddr reports the dialed address before the kernel knows
+	// it, but it has all the methods of one, such as CloseWrite and
+	// SyscallConn.
+	//
+	// The BlackholeCache does not learn how these dials fare, as
+	// their SYN goes out after the dial returns, but the option is
+	// left off for destinations where other dials turned Fast Open
+	// off.
+	FastOpenConnect bool
+
+	// DeferConnect makes DialContext return as soon as the address
+	// is resolved and the socket created. The connect happens on the
+	// first Write, whose data goes in the SYN when FastOpen is set,
+	// or on the first Read if that comes before any Write. Unlike
+	// FastOpenConnect, it works on every platform, but on Windows
+	// the data follows the handshake as with any other dial. Only
+	// the first address the host resolves to is dialed.
+	DeferConnect bool
+
+	// FastOpenFallback makes a dial that fails because the system
+	// refuses Fast Open, rather than because the peer cannot be
+	// reached, close its socket and dial again with a regular
+	// connect, sending the data once connected. ConnDialPath tells
+	// which way a connection was dialed.
+	FastOpenFallback bool
+
+	// BlackholeCache tracks the destinations where dials that send
+	// data in the SYN fail, and turns Fast Open off for them for a
+	// while, for FastOpen and FastOpenConnect alike. If nil,
+	// DefaultBlackholeCache is used.
+	BlackholeCache *BlackholeCache
+
+	// FallbackDelay specifies the length of time to wait before
+	// spawning a RFC 8305 Happy Eyeballs fallback connection, when
+	// the network is "tcp" and the host resolves to both IPv4 and
+	// IPv6 addresses. If zero, a default delay of 300ms is used. A
+	// negative value disables fallback.
+	FallbackDelay time.Duration
+
+	// Resolver optionally specifies an alternate resolver to use,
+	// such as a *net.Resolver. Lookups are bound by the deadline of
+	// the dial. If nil, net.DefaultResolver is used.
+	Resolver Resolver
+
+	// If Control is not nil, it is called after creating the network
+	// connection but before actually dialing. The network is "tcp4"
+	// or "tcp6", and the address is the one being dialed. If it
+	// returns an error, the dial fails with it.
+	//
+	// Control is ignored if ControlContext is not nil.
+	Control func(network, address string, c syscall.RawConn) error
+
+	// If ControlContext is not nil, it is called like Control, with
+	// the context of the dial.
+	ControlContext func(ctx context.Context, network, address string, c syscall.RawConn) error
+}
+
+// A Resolver looks up the IP addresses of a host for a Dialer.
+// *net.Resolver implements it, and a Resolver may be anything from a DNS
+// cache to a static map of hosts. If it also has a LookupPort method
+// like *net.Resolver, it is used for named services as well.
+//
+// IP address literals are not passed to the Resolver.
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+type portResolver interface {
+	LookupPort(ctx context.Context, network, service string) (int, error)
+}
+
+// control runs ControlContext or Control on the socket c about to dial
+// address.
+func (d *Dialer) control(ctx context.Context, network, address string, c syscall.RawConn) error {
+	if d.ControlContext != nil {
+		return d.ControlContext(ctx, network, address, c)
+	}
+	if d.Control != nil {
+		return d.Control(network, address, c)
+	}
+	return nil
+}
+
+type dataKey struct{}
+
+// WithData returns a copy of ctx carrying data to be sent with the
+// connection by Dialer.DialContext. When the Dialer has FastOpen set,
+// the data is sent in the SYN.
+func WithData(ctx context.Context, data []byte) context.Context {
+	return context.WithValue(ctx, dataKey{}, data)
+}
+
+func dataFromContext(ctx context.Context) []byte {
+	data, _ := ctx.Value(dataKey{}).([]byte)
+	return data
+}
+
+func minNonzeroTime(a, b time.Time) time.Time {
+	if a.IsZero() {
+		return b
+	}
+	if b.IsZero() || a.Before(b) {
+		return a
+	}
+	return b
+}
+
+// deadline returns the earliest of:
+//   - now+Timeout
+//   - d.Deadline
+//   - the context's deadline
+//
+// Or zero, if none of Timeout, Deadline, or context's deadline is set.
+func (d *Dialer) deadline(ctx context.Context, now time.Time) (earliest time.Time) {
+	if d.Timeout != 0 {
+		earliest = now.Add(d.Timeout)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		earliest = minNonzeroTime(earliest, deadline)
+	}
+	return minNonzeroTime(earliest, d.Deadline)
+}
+
+func (d *Dialer) resolver() Resolver {
+	if d.Resolver != nil {
+		return d.Resolver
+	}
+	return net.DefaultResolver
+}
+
+func (d *Dialer) lookupPort(ctx context.Context, network, service string) (int, error) {
+	if r, ok := d.resolver().(portResolver); ok {
+		return r.LookupPort(ctx, network, service)
+	}
+	return net.DefaultResolver.LookupPort(ctx, network, service)
+}
+
+// lookupIPAddr looks up host, which may be an IP address literal with
+// a zone.
+func (d *Dialer) lookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	ip, zone := host, ""
+	if i := strings.LastIndexByte(host, '%'); i > 0 {
+		ip, zone = host[:i], host[i+1:]
+	}
+	if ip := net.ParseIP(ip); ip != nil {
+		return []net.IPAddr{{IP: ip, Zone: zone}}, nil
+	}
+	return d.resolver().LookupIPAddr(ctx, host)
+}
+
+// resolveAddrList resolves address to the addresses to dial on network,
+// in the order the resolver returned them. Addresses that cannot be
+// dialed from laddr are left out.
+func (d *Dialer) resolveAddrList(ctx context.Context, network, address string, laddr *net.TCPAddr) ([]*net.TCPAddr, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, net.UnknownNetworkError(network)
+	}
+
+	host, service, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := d.lookupPort(ctx, network, service)
+	if err != nil {
+		return nil, err
+	}
+	if host == "" {
+		return []*net.TCPAddr{{Port: port}}, nil
+	}
+
+	addrs, err := d.lookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	var list []*net.TCPAddr
+	for _, addr := range addrs {
+		ipv4 := addr.IP.To4() != nil
+		switch {
+		case network == "tcp4" && !ipv4, network == "tcp6" && ipv4:
+			continue
+		case laddr != nil && laddr.IP != nil && (laddr.IP.To4() != nil) != ipv4:
+			continue
+		}
+		list = append(list, &net.TCPAddr{IP: addr.IP, Port: port, Zone: addr.Zone})
+	}
+	if len(list) == 0 {
+		return nil, &net.AddrError{Err: "no suitable address found", Addr: host}
+	}
+	return list, nil
+}
+
+// Dial connects to the address on the named network.
+//
+// See DialContext for details.
+func (d *Dialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+// DialContext connects to the address on the named network using the
+// provided context. The network must be "tcp", "tcp4" or "tcp6".
+//
+// When the host resolves to several addresses, they are tried in turn,
+// racing IPv6 against IPv4 as described for FallbackDelay, and each
+// attempt sends the data. RemoteAddr of the returned connection is the
+// address that won.
+//
+// Data attached to ctx with WithData is sent with the connection, in
+// the SYN when FastOpen is set.
+func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return d.dialContext(ctx, network, address, dataFromContext(ctx))
+}
+
+// dialContext returns a *net.TCPConn, a *fastOpenConn when
+// FastOpenConnect is set, or a *deferredConn when DeferConnect is set.
+func (d *Dialer) dialContext(ctx context.Context, network, address string, data []byte) (net.Conn, error) {
+	if ctx == nil {
+		panic("nil context")
+	}
+	deadline := d.deadline(ctx, time.Now())
+	if !deadline.IsZero() {
+		if d, ok := ctx.Deadline(); !ok || deadline.Before(d) {
+			subCtx, cancel := context.WithDeadline(ctx, deadline)
+			defer cancel()
+			ctx = subCtx
+		}
+	}
+
+	var laddr *net.TCPAddr
+	if d.LocalAddr != nil {
+		var ok bool
+		if laddr, ok = d.LocalAddr.(*net.TCPAddr); !ok {
+			return nil, opError("dial", network, nil, nil, &net.AddrError{Err: "mismatched local address type", Addr: d.LocalAddr.String()})
+		}
+	}
+
+	if err := d.connOptions().check(); err != nil {
+		return nil, opError("dial", network, laddr, nil, err)
+	}
+
+	addrs, err := d.resolveAddrList(ctx, network, address, laddr)
+	if err != nil {
+		return nil, opError("dial", network, laddr, nil, err)
+	}
+
+	if d.DeferConnect {
+		return d.dialDeferred(ctx, network, laddr, addrs[0], data)
+	}
+
+	var primaries, fallbacks []*net.TCPAddr
+	if d.FallbackDelay >= 0 && network == "tcp" {
+		primaries, fallbacks = partition(addrs)
+	} else {
+		primaries = addrs
+	}
+	c, raddr, err := d.dialParallel(ctx, network, laddr, primaries, fallbacks, data)
+	if err != nil {
+		return nil, opError("dial", network, laddr, nil, err)
+	}
+	if err := d.connOptions().apply(c); err != nil {
+		c.Close()
+		return nil, opError("dial", network, laddr, raddr, err)
+	}
+
+	if d.FastOpenConnect {
+		return &fastOpenConn{TCPConn: c, raddr: raddr}, nil
+	}
+	return c, nil
+}
+
+func (d *Dialer) dialTCP(ctx context.Context, network string, laddr, raddr *net.TCPAddr, data []byte) (*net.TCPConn, error) {
+	s, err := d.newDialSocket(ctx, network, laddr, raddr)
+	if err != nil {
+		return d.dialFailed(ctx, network, laddr, raddr, data, err)
+	}
+	return d.connect(ctx, s, network, laddr, raddr, data)
+}
+
+// connect connects s, which d created for raddr, sending data with it.
+// Data goes in the SYN unless the BlackholeCache has turned Fast Open
+// off for raddr, which newDialSocket also checked for FastOpenConnect.
+func (d *Dialer) connect(ctx context.Context, s *dialSocket, network string, laddr, raddr *net.TCPAddr, data []byte) (*net.TCPConn, error) {
+	bc := d.blackholeCache()
+	fastOpen := d.FastOpen
+	path := DialPathRegular
+	if clientFastOpen && (d.FastOpen || d.FastOpenConnect) {
+		path = DialPathFastOpen
+	}
+	if d.FastOpenConnect && !s.fastOpenConnect || fastOpen && len(data) > 0 && bc.disabled(raddr) {
+		fastOpen = false
+		path = DialPathBlackholed
+	}
+
+	c, err := s.connect(ctx, data, fastOpen)
+	if s.synBytes > 0 {
+		outcome := err
+		if err == nil && synDataLost(c) {
+			// A SYN with data that was dropped is retransmitted
+			// without it, and the dial merely completes late.
+			outcome = errSynDataLost
+		}
+		bc.report(raddr, outcome)
+	} else if err == nil && len(data) > 0 {
+		bc.reportPlain(raddr)
+	}
+	if err != nil {
+		return d.dialFailed(ctx, network, laddr, raddr, data, err)
+	}
+	recordDialPath(c, path)
+	return c, nil
+}
+
+func (d *Dialer) blackholeCache() *BlackholeCache {
+	if d.BlackholeCache != nil {
+		return d.BlackholeCache
+	}
+	return DefaultBlackholeCache
+}
+
+// dialFailed handles a dial to raddr that failed with err, falling back
+// to a regular connect if it can, and returns the error otherwise.
+func (d *Dialer) dialFailed(ctx context.Context, network string, laddr, raddr *net.TCPAddr, data []byte, err error) (*net.TCPConn, error) {
+	if d.canFallBack(err) {
+		return d.dialFallback(ctx, network, laddr, raddr, data)
+	}
+	return nil, d.dialError(network, laddr, raddr, err)
+}
+
+// dialError wraps err from a dial to raddr in a *net.OpError. If Fast
+// Open was refused, err is already marked with ErrFastOpenUnsupported
+// or ErrFastOpenDisabledByKernel.
+func (d *Dialer) dialError(network string, laddr, raddr *net.TCPAddr, err error) error {
+	return opError("dial", network, laddr, raddr, err)
+}
+
+// canFallBack reports whether a dial that failed with err may be retried
+// without Fast Open.
+func (d *Dialer) canFallBack(err error) bool {
+	return d.FastOpenFallback && (d.FastOpen || d.FastOpenConnect) && fastOpenErrorKind(err) != nil
+}
+
+// withoutFastOpen returns a copy of d that dials with a regular connect.
+func (d *Dialer) withoutFastOpen() *Dialer {
+	nd := *d
+	nd.FastOpen = false
+	nd.FastOpenConnect = false
+	nd.FastOpenFallback = false
+	return &nd
+}
+
+func (d *Dialer) dialFallback(ctx context.Context, network string, laddr, raddr *net.TCPAddr, data []byte) (*net.TCPConn, error) {
+	c, err := d.withoutFastOpen().dialTCP(ctx, network, laddr, raddr, data)
+	if err != nil {
+		return nil, err
+	}
+	recordDialPath(c, DialPathFallback)
+	return c, nil
+}
+
+func (d *Dialer) connOptions() connOptions {
+	return connOptions{
+		keepAlive:       d.KeepAlive,
+		keepAliveConfig: d.KeepAliveConfig,
+		userTimeout:     d.UserTimeout,
+		nagle:           d.Nagle,
+	}
+}
+
+// DialPath is the way a connection was dialed.
+type DialPath uint8
+
+const (
+	// DialPathRegular is a regular connect, without Fast Open.
+	DialPathRegular DialPath = iota
+	// DialPathFastOpen is a connect with Fast Open, which sent the
+	// data in the SYN if the kernel had a cookie for the peer. It is
+	// never reported on Windows; see Dialer.FastOpen.
+	DialPathFastOpen
+	// DialPathFallback is a regular connect made after Fast Open
+	// failed, by a Dialer with FastOpenFallback set.
+	DialPathFallback
+	// DialPathBlackholed is a regular connect made because the
+	// Dialer's BlackholeCache has turned Fast Open off for the
+	// destination.
+	DialPathBlackholed
+)
+
+func (p DialPath) String() string {
+	switch p {
+	case DialPathRegular:
+		return "regular"
+	case DialPathFastOpen:
+		return "fast open"
+	case DialPathFallback:
+		return "fallback"
+	case DialPathBlackholed:
+		return "blackholed"
+	}
+	return "unknown"
+}
+
+// ConnDialPath returns the way c was dialed. Connections that did not
+// come from a Dialer, and ones from DeferConnect that are not connected
+// yet, report DialPathRegular.
+func ConnDialPath(c net.Conn) DialPath {
+	return lookupRecord(c).path
+}
+
+// fastOpenConn is a connection dialed with TCP_FASTOPEN_CONNECT. Until
+// the first Write sends the SYN, the kernel has no peer address for it,
+// so the net package could not record one.
+type fastOpenConn struct {
+	*net.TCPConn
+	raddr net.Addr
+}
+
+// RemoteAddr returns the remote network address.
+func (c *fastOpenConn) RemoteAddr() net.Addr {
+	return c.raddr
+}
+
+func Dial(address string, fastOpen bool, data []byte) (*net.TCPConn, error) {
+	return DialContext(context.Background(), address, fastOpen, data)
+}
+
+// DialTCP is like Dial but takes the network to dial on,
+// which must be "tcp", "tcp4" or "tcp6".
+func DialTCP(network, address string, fastOpen bool, data []byte) (*net.TCPConn, error) {
+	return DialTCPContext(context.Background(), network, address, fastOpen, data)
+}
+
+func DialContext(ctx context.Context, address string, fastOpen bool, data []byte) (*net.TCPConn, error) {
+	return DialTCPContext(ctx, "tcp", address, fastOpen, data)
+}
+
+// DialTCPContext is like DialContext but takes the network to dial on,
+// which must be "tcp", "tcp4" or "tcp6".
+func DialTCPContext(ctx context.Context, network, address string, fastOpen bool, data []byte) (*net.TCPConn, error) {
+	d := Dialer{FastOpen: fastOpen, KeepAlive: -1}
+	c, err := d.dialContext(ctx, network, address, data)
+	if err != nil {
+		return nil, err
+	}
+	return c.(*net.TCPConn), nil
+}
+
+// ListenConfig contains options for listening to an address. It mirrors
+// net.ListenConfig.
+type ListenConfig struct {
+	// Backlog is the maximum length of the queue of pending
+	// connections passed to listen(2). If zero, syscall.SOMAXCONN
+	// is used.
+	//
+	// It is ignored on Windows, where the net package opens the
+	// listener and always passes syscall.SOMAXCONN.
+	Backlog int
+
+	// FastOpen enables TCP Fast Open on the listener.
+	FastOpen bool
+
+	// FastOpenQueueLen is the maximum number of pending Fast Open
+	// requests that have not completed the handshake, the value of
+	// the TCP_FASTOPEN socket option on Linux. If zero, Backlog is
+	// used. Other platforms take no queue length and ignore it.
+	FastOpenQueueLen int
+
+	// FastOpenKeys are the keys the listener makes and checks Fast
+	// Open cookies with, instead of the keys of the network
+	// namespace. The first is the primary key, which new cookies
+	// are made with, and the second, if any, a backup key that
+	// cookies are also accepted with. They can be changed later
+	// with TFOListener.SetFastOpenKeys. Keys are only supported on
+	// Linux, from 4.20, and a backup key from 5.3.
+	FastOpenKeys []FastOpenKey
+
+	// KeepAlive specifies the keep-alive period for accepted
+	// connections. If zero, keep-alives are enabled with a default
+	// period of 15 seconds. If negative, keep-alives are disabled.
+	KeepAlive time.Duration
+
+	// KeepAliveConfig specifies the keep-alive probe configuration
+	// for accepted connections, as for net.ListenConfig. If
+	// KeepAliveConfig.Enable is true, keep-alive probes are
+	// enabled. If KeepAliveConfig.Enable is false and KeepAlive is
+	// negative, they are disabled.
+	KeepAliveConfig net.KeepAliveConfig
+
+	// UserTimeout is the TCP_USER_TIMEOUT of accepted connections,
+	// as for Dialer.UserTimeout. Outside Linux, listening with it
+	// fails.
+	UserTimeout time.Duration
+
+	// Nagle leaves Nagle's algorithm on for accepted connections.
+	Nagle bool
+
+	// ReusePort sets SO_REUSEPORT, so that several sockets may
+	// listen on the same address. It is not supported on Windows.
+	ReusePort bool
+
+	// SteerByCPU makes ListenGroup attach a classic BPF program to
+	// its listeners, with SO_ATTACH_REUSEPORT_CBPF, that hands each
+	// connection to a listener by the CPU that handles it. It is
+	// only supported on Linux, and ignored by Listen.
+	SteerByCPU bool
+
+	// If Control is not nil, it is called after creating the network
+	// connection but before binding it to the operating system.
+	Control func(network, address string, c syscall.RawConn) error
+}
+
+func (lc *ListenConfig) connOptions() connOptions {
+	return connOptions{
+		keepAlive:       lc.KeepAlive,
+		keepAliveConfig: lc.KeepAliveConfig,
+		userTimeout:     lc.UserTimeout,
+		nagle:           lc.Nagle,
+	}
+}
+
+func (lc *ListenConfig) backlog() int {
+	if lc.Backlog > 0 {
+		return lc.Backlog
+	}
+	return syscall.SOMAXCONN
+}
+
+// Listen announces on the local network address. The network must be
+// "tcp", "tcp4" or "tcp6".
+func (lc *ListenConfig) Listen(ctx context.Context, network, address string) (net.Listener, error) {
+	laddr, err := net.ResolveTCPAddr(network, address)
+	if err != nil {
+		return nil, opError("listen", network, nil, nil, err)
+	}
+	if err := lc.connOptions().check(); err != nil {
+		return nil, opError("listen", network, nil, laddr, err)
+	}
+	ln, err := lc.listenTCP(ctx, network, laddr)
+	if err != nil {
+		return nil, opError("listen", network, nil, laddr, err)
+	}
+	return ln, nil
+}
+
+func Listen(address string, fastOpen bool) (net.Listener, error) {
+	return ListenTCP("tcp", address, fastOpen)
+}
+
+// ListenTCP is like Listen but takes the network to listen on,
+// which must be "tcp", "tcp4" or "tcp6".
+func ListenTCP(network, address string, fastOpen bool) (net.Listener, error) {
+	lc := ListenConfig{FastOpen: fastOpen}
+	return lc.Listen(context.Background(), network, address)
+}
+
+// ctrlNetwork returns the network name passed to Control hooks, which
+// always carries the address family like the net package's.
+func ctrlNetwork(network string, family int) string {
+	if network == "tcp4" || family == syscall.AF_INET {
+		return "tcp4"
+	}
+	return "tcp6"
+}
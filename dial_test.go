@@ -0,0 +1,345 @@
+package gotfo
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fillAcceptQueue makes connects to ln hang, by filling its accept
+// queue with connections that are never accepted, so that the kernel
+// drops further SYNs. ln must have a small backlog.
+func fillAcceptQueue(t *testing.T, ln net.Listener) {
+	t.Helper()
+	for range 16 {
+		c, err := net.DialTimeout("tcp", ln.Addr().String(), 100*time.Millisecond)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				return
+			}
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { c.Close() })
+	}
+	t.Skip("cannot fill the accept queue of a listener")
+}
+
+// newHangingListener returns a listener on address that connects hang
+// on.
+func newHangingListener(t *testing.T, network, address string) net.Listener {
+	t.Helper()
+	ln, err := (&ListenConfig{Backlog: 1}).Listen(context.Background(), network, address)
+	if err != nil {
+		t.Skipf("cannot listen on %s %s: %v", network, address, err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	fillAcceptQueue(t, ln)
+	return ln
+}
+
+// serveEcho echoes what it reads on every connection accepted on ln.
+func serveEcho(ln net.Listener) {
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer c.Close()
+			io.Copy(c, c)
+		}()
+	}
+}
+
+// TestDialListen checks that connections from Dial to a listener from
+// Listen carry the data both ways, with and without Fast Open.
+func TestDialListen(t *testing.T) {
+	for _, fastOpen := range []bool{false, true} {
+		ln, err := Listen("127.0.0.1:0", fastOpen)
+		if err != nil {
+			t.Fatalf("FastOpen %v: %v", fastOpen, err)
+		}
+		go serveEcho(ln)
+		c, err := Dial(ln.Addr().String(), fastOpen, []byte("hello"))
+		if err != nil {
+			ln.Close()
+			t.Fatalf("FastOpen %v: %v", fastOpen, err)
+		}
+		b := make([]byte, 5)
+		_, err = io.ReadFull(c, b)
+		c.Close()
+		ln.Close()
+		if err != nil || string(b) != "hello" {
+			t.Fatalf("FastOpen %v: read %q, %v, want the data echoed", fastOpen, b, err)
+		}
+	}
+}
+
+func TestDialWithData(t *testing.T) {
+	ln := newTestListener(t)
+	go serveEcho(ln)
+
+	for _, fastOpen := range []bool{false, true} {
+		d := &Dialer{FastOpen: fastOpen, Timeout: 5 * time.Second}
+		c, err := d.DialContext(WithData(context.Background(), []byte("hello")), "tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatalf("FastOpen %v: %v", fastOpen, err)
+		}
+		b := make([]byte, 5)
+		_, err = io.ReadFull(c, b)
+		c.Close()
+		if err != nil || string(b) != "hello" {
+			t.Fatalf("FastOpen %v: read %q, %v, want the data echoed", fastOpen, b, err)
+		}
+	}
+}
+
+func TestDialContextCanceled(t *testing.T) {
+	ln := newHangingListener(t, "tcp4", "127.0.0.1:0")
+
+	for _, fastOpen := range []bool{false, true} {
+		d := &Dialer{FastOpen: fastOpen}
+		ctx, cancel := context.WithCancel(WithData(context.Background(), []byte("hello")))
+		time.AfterFunc(50*time.Millisecond, cancel)
+		start := time.Now()
+		c, err := d.DialContext(ctx, "tcp", ln.Addr().String())
+		if err == nil {
+			c.Close()
+			t.Fatalf("FastOpen %v: dial succeeded", fastOpen)
+		}
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("FastOpen %v: DialContext = %v, want context.Canceled", fastOpen, err)
+		}
+		var oe *net.OpError
+		if !errors.As(err, &oe) || oe.Op != "dial" {
+			t.Fatalf("FastOpen %v: DialContext = %v, want a dial *net.OpError", fastOpen, err)
+		}
+		if d := time.Since(start); d > 2*time.Second {
+			t.Fatalf("FastOpen %v: dial took %v to give up", fastOpen, d)
+		}
+	}
+}
+
+func TestDialTimeout(t *testing.T) {
+	ln := newHangingListener(t, "tcp4", "127.0.0.1:0")
+
+	d := &Dialer{Timeout: 50 * time.Millisecond}
+	_, err := d.Dial("tcp", ln.Addr().String())
+	if !errors.Is(err, os.ErrDeadlineExceeded) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Dial = %v, want a timeout", err)
+	}
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Fatalf("Dial = %v, want a net.Error with Timeout", err)
+	}
+}
+
+func TestDialCanceledBeforeStart(t *testing.T) {
+	ln := newTestListener(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c, err := (&Dialer{}).DialContext(ctx, "tcp", ln.Addr().String())
+	if err == nil {
+		c.Close()
+		t.Fatal("dial succeeded with a canceled context")
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("DialContext = %v, want context.Canceled", err)
+	}
+}
+
+// TestDialFastOpenConnect dials with TCP_FASTOPEN_CONNECT twice: the
+// first dial connects and asks for a cookie, and when the listener has
+// Fast Open on, the second returns without sending anything and the SYN
+// goes out with the first Write.
+func TestDialFastOpenConnect(t *testing.T) {
+	caps, err := Capabilities()
+	if err != nil || !caps.FastOpenConnect {
+		t.Skip("TCP_FASTOPEN_CONNECT is not supported")
+	}
+	ln, err := (&ListenConfig{FastOpen: caps.Server}).Listen(context.Background(), "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	d := &Dialer{FastOpenConnect: true, BlackholeCache: &BlackholeCache{}, Timeout: 5 * time.Second}
+
+	if !caps.Client {
+		_, err := d.Dial("tcp", ln.Addr().String())
+		if !errors.Is(err, ErrFastOpenDisabledByKernel) {
+			t.Fatalf("Dial = %v, want ErrFastOpenDisabledByKernel", err)
+		}
+		return
+	}
+
+	go serveEcho(ln)
+	dial := func() net.Conn {
+		t.Helper()
+		c, err := d.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := c.(*net.TCPConn); ok {
+			t.Fatal("Dial returned a *net.TCPConn")
+		}
+		if ra := c.RemoteAddr().String(); ra != ln.Addr().String() {
+			t.Fatalf("RemoteAddr = %v, want %v", ra, ln.Addr())
+		}
+		if p := ConnDialPath(c); p != DialPathFastOpen {
+			t.Fatalf("ConnDialPath = %v, want %v", p, DialPathFastOpen)
+		}
+		return c
+	}
+	echo := func(c net.Conn) {
+		t.Helper()
+		if _, err := c.Write([]byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		b := make([]byte, 5)
+		if _, err := io.ReadFull(c, b); err != nil || string(b) != "hello" {
+			t.Fatalf("read %q, %v, want the data echoed", b, err)
+		}
+	}
+
+	c := dial()
+	echo(c)
+	c.Close()
+	if !caps.Server {
+		return
+	}
+
+	c = dial()
+	defer c.Close()
+	if ra := c.(*fastOpenConn).TCPConn.RemoteAddr(); ra != nil {
+		t.Fatalf("connected to %v before the first Write", ra)
+	}
+	echo(c)
+	info, err := FastOpenStatus(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.SynData {
+		t.Fatalf("FastOpenStatus = %+v, want the first Write in the SYN", info)
+	}
+}
+
+// TestDialFallback has Fast Open refused on the first dial, as a kernel
+// without it would, and checks that the dial is made again with a
+// regular connect that delivers the data.
+func TestDialFallback(t *testing.T) {
+	ln := newTestListener(t)
+	go serveEcho(ln)
+
+	calls := 0
+	d := &Dialer{
+		FastOpen:         true,
+		FastOpenFallback: true,
+		Timeout:          5 * time.Second,
+		Control: func(network, address string, c syscall.RawConn) error {
+			calls++
+			if calls == 1 {
+				return fastOpenSyscallError("setsockopt", syscall.ENOPROTOOPT)
+			}
+			return nil
+		},
+	}
+	c, err := d.DialContext(WithData(context.Background(), []byte("hello")), "tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if calls != 2 {
+		t.Fatalf("Control called %d times, want 2", calls)
+	}
+	if p := ConnDialPath(c); p != DialPathFallback {
+		t.Fatalf("ConnDialPath = %v, want %v", p, DialPathFallback)
+	}
+	b := make([]byte, 5)
+	if _, err := io.ReadFull(c, b); err != nil || string(b) != "hello" {
+		t.Fatalf("read %q, %v, want the data echoed", b, err)
+	}
+
+	// Without FastOpenFallback, the refusal is returned.
+	calls = 0
+	d.FastOpenFallback = false
+	if _, err := d.DialContext(WithData(context.Background(), []byte("hello")), "tcp", ln.Addr().String()); !errors.Is(err, ErrFastOpenUnsupported) {
+		t.Fatalf("DialContext = %v, want ErrFastOpenUnsupported", err)
+	}
+}
+
+// TestDialLocalAddr dials from 127.0.0.2 and checks that the peer sees
+// the connection come from there.
+func TestDialLocalAddr(t *testing.T) {
+	ln := newTestListener(t)
+	laddr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 2)}
+
+	for _, fastOpen := range []bool{false, true} {
+		d := &Dialer{LocalAddr: laddr, FastOpen: fastOpen, Timeout: 5 * time.Second}
+		c, err := d.DialContext(WithData(context.Background(), []byte("hello")), "tcp", ln.Addr().String())
+		if errors.Is(err, syscall.EADDRNOTAVAIL) {
+			t.Skip("127.0.0.2 is not a local address")
+		}
+		if err != nil {
+			t.Fatalf("FastOpen %v: %v", fastOpen, err)
+		}
+		sc, err := ln.Accept()
+		if err != nil {
+			c.Close()
+			t.Fatal(err)
+		}
+		local := c.LocalAddr().(*net.TCPAddr)
+		remote := sc.RemoteAddr().(*net.TCPAddr)
+		c.Close()
+		sc.Close()
+		if !local.IP.Equal(laddr.IP) || !remote.IP.Equal(laddr.IP) || local.Port != remote.Port {
+			t.Fatalf("FastOpen %v: dialed from %v, accepted from %v, want %v", fastOpen, local, remote, laddr.IP)
+		}
+	}
+
+	// Only addresses of the family of LocalAddr are dialed.
+	d := &Dialer{LocalAddr: laddr}
+	if _, err := d.Dial("tcp", "[::1]:1"); err == nil {
+		t.Fatal("dialed an IPv6 address from an IPv4 one")
+	}
+}
+
+// TestDialControlContext checks that ControlContext gets the context of
+// the dial, that it is used instead of Control, and that its error
+// aborts the dial.
+func TestDialControlContext(t *testing.T) {
+	ln := newTestListener(t)
+	type ctxKey struct{}
+	errControl := errors.New("control failed")
+
+	var got any
+	d := &Dialer{
+		Control: func(network, address string, c syscall.RawConn) error {
+			t.Error("Control called alongside ControlContext")
+			return nil
+		},
+		ControlContext: func(ctx context.Context, network, address string, c syscall.RawConn) error {
+			got = ctx.Value(ctxKey{})
+			if network != "tcp4" || address != ln.Addr().String() {
+				t.Errorf("ControlContext(%s, %s), want tcp4 and %v", network, address, ln.Addr())
+			}
+			return errControl
+		},
+	}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "value")
+	c, err := d.DialContext(ctx, "tcp", ln.Addr().String())
+	if err == nil {
+		c.Close()
+		t.Fatal("dial succeeded")
+	}
+	if !errors.Is(err, errControl) {
+		t.Fatalf("DialContext = %v, want the ControlContext error", err)
+	}
+	if got != "value" {
+		t.Fatalf("ControlContext got context value %v, want that of the dial", got)
+	}
+}
@@ -0,0 +1,108 @@
+package gotfo
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"syscall"
+)
+
+var (
+	// ErrFastOpenUnsupported is wrapped by errors from dials and
+	// listens that failed because the platform or kernel does not
+	// support Fast Open, or the option asked for.
+	ErrFastOpenUnsupported = errors.New("gotfo: TCP Fast Open is not supported")
+
+	// ErrFastOpenDisabledByKernel is wrapped by errors from dials
+	// that failed because the kernel supports Fast Open but its
+	// configuration turns off the client side, as the
+	// net.ipv4.tcp_fastopen sysctl can on Linux.
+	ErrFastOpenDisabledByKernel = errors.New("gotfo: TCP Fast Open is disabled by the kernel")
+
+	// ErrClosed is returned by operations on a closed connection. It
+	// is net.ErrClosed, so either can be matched with errors.Is.
+	ErrClosed = net.ErrClosed
+)
+
+var (
+	errTimeout  error = &timeoutError{}
+	errCanceled error = &canceledError{}
+)
+
+// timeoutError is returned when a dial times out. It is a net.Error
+// whose Timeout method reports true, and it matches both
+// context.DeadlineExceeded and os.ErrDeadlineExceeded with errors.Is.
+type timeoutError struct{}
+
+func (e *timeoutError) Error() string   { return "i/o timeout" }
+func (e *timeoutError) Timeout() bool   { return true }
+func (e *timeoutError) Temporary() bool { return true }
+
+func (e *timeoutError) Is(err error) bool {
+	return err == context.DeadlineExceeded || err == os.ErrDeadlineExceeded
+}
+
+// canceledError is returned when the context of a dial is canceled. It
+// matches context.Canceled with errors.Is.
+type canceledError struct{}
+
+func (e *canceledError) Error() string { return "operation was canceled" }
+
+func (e *canceledError) Is(err error) bool { return err == context.Canceled }
+
+// fastOpenError is a system error that says Fast Open was refused. It
+// matches both kind, which is ErrFastOpenUnsupported or
+// ErrFastOpenDisabledByKernel, and the system error with errors.Is.
+type fastOpenError struct {
+	kind error
+	err  error
+}
+
+func (e *fastOpenError) Error() string   { return e.kind.Error() + ": " + e.err.Error() }
+func (e *fastOpenError) Unwrap() []error { return []error{e.kind, e.err} }
+
+// fastOpenSyscallError wraps err from a system call that only Fast Open
+// makes in an *os.SyscallError, and marks it with
+// ErrFastOpenUnsupported or ErrFastOpenDisabledByKernel if it says Fast
+// Open is refused. Errors are only marked here, where the call is known
+// to be about Fast Open, and never guessed from the call name later.
+func fastOpenSyscallError(call string, err error) error {
+	se := os.NewSyscallError(call, err)
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		if kind := fastOpenErrnoKind(errno); kind != nil {
+			return &fastOpenError{kind: kind, err: se}
+		}
+	}
+	return se
+}
+
+// fastOpenErrorKind returns ErrFastOpenUnsupported or
+// ErrFastOpenDisabledByKernel if err was marked with it, or nil.
+func fastOpenErrorKind(err error) error {
+	switch {
+	case errors.Is(err, ErrFastOpenDisabledByKernel):
+		return ErrFastOpenDisabledByKernel
+	case errors.Is(err, ErrFastOpenUnsupported):
+		return ErrFastOpenUnsupported
+	}
+	return nil
+}
+
+// opError wraps err from operation op in a *net.OpError, unless it is
+// one already.
+func opError(op, network string, source, addr *net.TCPAddr, err error) error {
+	if _, ok := err.(*net.OpError); ok {
+		return err
+	}
+	oe := &net.OpError{Op: op, Net: network, Err: err}
+	// Leave out nil addresses, which would be non-nil net.Addrs.
+	if source != nil {
+		oe.Source = source
+	}
+	if addr != nil {
+		oe.Addr = addr
+	}
+	return oe
+}
@@ -0,0 +1,59 @@
+package gotfo
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestFastOpenSyscallError(t *testing.T) {
+	err := fastOpenSyscallError("setsockopt", syscall.ENOPROTOOPT)
+	if !errors.Is(err, ErrFastOpenUnsupported) {
+		t.Fatalf("%v does not match ErrFastOpenUnsupported", err)
+	}
+	if !errors.Is(err, syscall.ENOPROTOOPT) {
+		t.Fatalf("%v does not match the errno", err)
+	}
+	var se *os.SyscallError
+	if !errors.As(err, &se) || se.Syscall != "setsockopt" {
+		t.Fatalf("%v is not a setsockopt *os.SyscallError", err)
+	}
+
+	if err := fastOpenSyscallError("sendmsg", syscall.ECONNREFUSED); fastOpenErrorKind(err) != nil {
+		t.Fatalf("%v is marked as a Fast Open error", err)
+	}
+}
+
+// TestControlErrorNotFastOpen checks that an error from a Control hook
+// that looks like a refused socket option is not taken for Fast Open
+// being refused, so that the dial is not retried without it.
+func TestControlErrorNotFastOpen(t *testing.T) {
+	ln := newTestListener(t)
+
+	calls := 0
+	d := &Dialer{
+		FastOpen:         true,
+		FastOpenFallback: true,
+		Control: func(network, address string, c syscall.RawConn) error {
+			calls++
+			return os.NewSyscallError("setsockopt", syscall.ENOPROTOOPT)
+		},
+	}
+	_, err := d.DialContext(WithData(context.Background(), []byte("hello")), "tcp", ln.Addr().String())
+	if !errors.Is(err, syscall.ENOPROTOOPT) {
+		t.Fatalf("DialContext = %v, want the Control error", err)
+	}
+	if errors.Is(err, ErrFastOpenUnsupported) || errors.Is(err, ErrFastOpenDisabledByKernel) {
+		t.Fatalf("DialContext = %v, marked as a Fast Open error", err)
+	}
+	var oe *net.OpError
+	if !errors.As(err, &oe) || oe.Op != "dial" {
+		t.Fatalf("DialContext = %v, want a dial *net.OpError", err)
+	}
+	if calls != 1 {
+		t.Fatalf("Control called %d times, want 1", calls)
+	}
+}
@@ -0,0 +1,78 @@
+package gotfo
+
+import (
+	"errors"
+)
+
+// A FastOpenKey is a key that a listener makes Fast Open cookies with.
+// Listeners that share their keys accept each other's cookies, so that
+// clients of several hosts behind one address do not miss Fast Open
+// when they reach another host than the one that issued their cookie.
+type FastOpenKey [16]byte
+
+var errFastOpenKeyCount = errors.New("gotfo: one or two Fast Open keys are needed")
+
+// fastOpenKeyBytes returns keys as the TCP_FASTOPEN_KEY option takes
+// them: the primary key, followed by the backup key if there is one.
+func fastOpenKeyBytes(keys []FastOpenKey) ([]byte, error) {
+	if len(keys) < 1 || len(keys) > 2 {
+		return nil, errFastOpenKeyCount
+	}
+	b := make([]byte, 0, len(keys)*len(FastOpenKey{}))
+	for _, key := range keys {
+		b = append(b, key[:]...)
+	}
+	return b, nil
+}
+
+// SetFastOpenKeys sets the keys of the listener, the TCP_FASTOPEN_KEY
+// socket option, as ListenConfig.FastOpenKeys does when listening.
+// Connections already accepted or in the queue are not affected.
+func (l *TFOListener) SetFastOpenKeys(keys ...FastOpenKey) error {
+	b, err := fastOpenKeyBytes(keys)
+	if err != nil {
+		return err
+	}
+	rc, err := l.SyscallConn()
+	if err != nil {
+		return err
+	}
+	return setFastOpenKeys(rc, b)
+}
+
+// FastOpenKeys returns the keys of the listener, primary first. Without
+// keys of its own, these are the keys of the network namespace.
+func (l *TFOListener) FastOpenKeys() ([]FastOpenKey, error) {
+	rc, err := l.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	b, err := getFastOpenKeys(rc)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]FastOpenKey, len(b)/len(FastOpenKey{}))
+	for i := range keys {
+		copy(keys[i][:], b[i*len(FastOpenKey{}):])
+	}
+	return keys, nil
+}
+
+// RotateFastOpenKey makes key the primary key of the listener, and the
+// current primary key its backup. Cookies made with either are accepted,
+// so clients holding a cookie made before the rotation keep using Fast
+// Open, and get a cookie made with key on their next connection.
+//
+// Rotating needs backup keys, which Linux supports from 5.3. Hosts
+// sharing keys should all rotate to the same key, and do so less often
+// than clients reconnect, or clients fall back to a full handshake.
+func (l *TFOListener) RotateFastOpenKey(key FastOpenKey) error {
+	keys, err := l.FastOpenKeys()
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 || keys[0] == key {
+		return l.SetFastOpenKeys(key)
+	}
+	return l.SetFastOpenKeys(key, keys[0])
+}
@@ -0,0 +1,82 @@
+package gotfo
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestFastOpenKeyCount(t *testing.T) {
+	for _, keys := range [][]FastOpenKey{nil, make([]FastOpenKey, 3)} {
+		if _, err := fastOpenKeyBytes(keys); !errors.Is(err, errFastOpenKeyCount) {
+			t.Errorf("fastOpenKeyBytes with %d keys = %v, want errFastOpenKeyCount", len(keys), err)
+		}
+		if keys == nil {
+			// A ListenConfig without keys keeps those of the
+			// network namespace.
+			continue
+		}
+		lc := &ListenConfig{FastOpen: true, FastOpenKeys: keys}
+		if ln, err := lc.Listen(context.Background(), "tcp", "127.0.0.1:0"); !errors.Is(err, errFastOpenKeyCount) {
+			if err == nil {
+				ln.Close()
+			}
+			t.Errorf("Listen with %d keys = %v, want errFastOpenKeyCount", len(keys), err)
+		}
+	}
+
+	b, err := fastOpenKeyBytes([]FastOpenKey{{1}, {2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != 32 || b[0] != 1 || b[16] != 2 {
+		t.Fatalf("fastOpenKeyBytes = %x, want the primary key then the backup", b)
+	}
+}
+
+// TestFastOpenKeys sets the keys of a listener, reads them back and
+// rotates them.
+func TestFastOpenKeys(t *testing.T) {
+	if caps, err := Capabilities(); err != nil || !caps.FastOpenKey {
+		t.Skip("TCP_FASTOPEN_KEY is not supported")
+	}
+	k1, k2, k3 := FastOpenKey{1}, FastOpenKey{2}, FastOpenKey{3}
+
+	lc := &ListenConfig{FastOpen: true, FastOpenKeys: []FastOpenKey{k1}}
+	ln, err := lc.Listen(context.Background(), "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	l := ln.(*TFOListener)
+
+	check := func(want ...FastOpenKey) {
+		t.Helper()
+		keys, err := l.FastOpenKeys()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(keys, want) {
+			t.Fatalf("FastOpenKeys = %x, want %x", keys, want)
+		}
+	}
+	check(k1)
+
+	if err := l.RotateFastOpenKey(k2); err != nil {
+		t.Fatal(err)
+	}
+	check(k2, k1)
+	if err := l.RotateFastOpenKey(k3); err != nil {
+		t.Fatal(err)
+	}
+	check(k3, k2)
+
+	if err := l.SetFastOpenKeys(k1); err != nil {
+		t.Fatal(err)
+	}
+	check(k1)
+	if err := l.SetFastOpenKeys(); !errors.Is(err, errFastOpenKeyCount) {
+		t.Fatalf("SetFastOpenKeys with no keys = %v, want errFastOpenKeyCount", err)
+	}
+}
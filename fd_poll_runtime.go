@@ -1,117 +0,0 @@
-package gotfo
-
-import (
-	"errors"
-	"time"
-)
-
-func (pd *pollDesc) close() {
-	if pd.runtimeCtx == 0 {
-		return
-	}
-	runtime_pollClose(pd.runtimeCtx)
-	pd.runtimeCtx = 0
-}
-
-// Evict evicts fd from the pending list, unblocking any I/O running on fd.
-func (pd *pollDesc) evict() {
-	if pd.runtimeCtx == 0 {
-		return
-	}
-	runtime_pollUnblock(pd.runtimeCtx)
-}
-
-func (pd *pollDesc) prepare(mode int) error {
-	if pd.runtimeCtx == 0 {
-		return nil
-	}
-	res := runtime_pollReset(pd.runtimeCtx, mode)
-	return convertErr(res)
-}
-
-func (pd *pollDesc) prepareRead(isFile bool) error {
-	return pd.prepare('r')
-}
-
-func (pd *pollDesc) prepareWrite(isFile bool) error {
-	return pd.prepare('w')
-}
-
-func (pd *pollDesc) wait(mode int) error {
-	if pd.runtimeCtx == 0 {
-		return errors.New("waiting for unsupported file type")
-	}
-	res := runtime_pollWait(pd.runtimeCtx, mode)
-	return convertErr(res)
-}
-
-func (pd *pollDesc) waitRead() error {
-	return pd.wait('r')
-}
-
-func (pd *pollDesc) waitWrite() error {
-	return pd.wait('w')
-}
-
-func (pd *pollDesc) waitCanceled(mode int) {
-	if pd.runtimeCtx == 0 {
-		return
-	}
-	runtime_pollWaitCanceled(pd.runtimeCtx, mode)
-}
-
-func (pd *pollDesc) pollable() bool {
-	return pd.runtimeCtx != 0
-}
-
-func convertErr(res int) error {
-	switch res {
-	case 0:
-		return nil
-	case 1:
-		return errClosing
-	case 2:
-		return errTimeout
-	}
-	println("unreachable: ", res)
-	panic("unreachable")
-}
-
-// SetDeadline sets the read and write deadlines associated with fd.
-func (fd *netFD) SetDeadline(t time.Time) error {
-	return setDeadlineImpl(fd, t, 'r'+'w')
-}
-
-// SetReadDeadline sets the read deadline associated with fd.
-func (fd *netFD) SetReadDeadline(t time.Time) error {
-	return setDeadlineImpl(fd, t, 'r')
-}
-
-// SetWriteDeadline sets the write deadline associated with fd.
-func (fd *netFD) SetWriteDeadline(t time.Time) error {
-	return setDeadlineImpl(fd, t, 'w')
-}
-
-func setDeadlineImpl(fd *netFD, t time.Time, mode int) error {
-	diff := int64(time.Until(t))
-	d := runtimeNano() + diff
-	if d <= 0 && diff > 0 {
-		// If the user has a deadline in the future, but the delay calculation
-		// overflows, then set the deadline to the maximum possible value.
-		d = 1<<63 - 1
-	}
-	if t.IsZero() {
-		d = 0
-	}
-	if err := fd.incref(); err != nil {
-		return err
-	}
-
-	// https://github.com/golang/go/commit/3813f941f6ff80f64d14db35f8b6446e10e45411#diff-2fac41fb57b6d5728ad14f6115f7219b
-	defer fd.decref()
-	if fd.pd.runtimeCtx == 0 {
-		return errors.New("file type does not support deadlines")
-	}
-	runtime_pollSetDeadline(fd.pd.runtimeCtx, d, mode)
-	return nil
-}
@@ -1,69 +0,0 @@
-// Copyright 2013 The Go Authors. All rights reserved.
-// Use of this source code is governed by a BSD-style
-// license that can be found in the LICENSE file.
-
-// +build go1.9
-
-// Note: internal/poll.FD renamed to pollFD
-// Note: isFile param is ignored
-
-package gotfo
-
-import (
-	"sync"
-	"syscall"
-	_ "unsafe"
-)
-
-//go:linkname runtime_pollServerInit internal/poll.runtime_pollServerInit
-func runtime_pollServerInit()
-
-//go:linkname runtime_pollOpen internal/poll.runtime_pollOpen
-func runtime_pollOpen(fd uintptr) (uintptr, int)
-
-//go:linkname runtimeNano internal/poll.runtimeNano
-func runtimeNano() int64
-
-//go:linkname runtime_pollClose internal/poll.runtime_pollClose
-func runtime_pollClose(ctx uintptr)
-
-//go:linkname runtime_pollWait internal/poll.runtime_pollWait
-func runtime_pollWait(ctx uintptr, mode int) int
-
-//go:linkname runtime_pollWaitCanceled internal/poll.runtime_pollWaitCanceled
-func runtime_pollWaitCanceled(ctx uintptr, mode int) int
-
-//go:linkname runtime_pollReset internal/poll.runtime_pollReset
-func runtime_pollReset(ctx uintptr, mode int) int
-
-//go:linkname runtime_pollSetDeadline internal/poll.runtime_pollSetDeadline
-func runtime_pollSetDeadline(ctx uintptr, d int64, mode int)
-
-//go:linkname runtime_pollUnblock internal/poll.runtime_pollUnblock
-func runtime_pollUnblock(ctx uintptr)
-
-//go:linkname runtime_Semacquire internal/poll.runtime_Semacquire
-func runtime_Semacquire(sema *uint32)
-
-//go:linkname runtime_Semrelease internal/poll.runtime_Semrelease
-func runtime_Semrelease(sema *uint32)
-
-type pollDesc struct {
-	runtimeCtx uintptr
-}
-
-var serverInit sync.Once
-
-func (pd *pollDesc) init(fd *netFD) error {
-	serverInit.Do(runtime_pollServerInit)
-	ctx, errno := runtime_pollOpen(uintptr(fd.sysfd))
-	if errno != 0 {
-		if ctx != 0 {
-			runtime_pollUnblock(ctx)
-			runtime_pollClose(ctx)
-		}
-		return syscall.Errno(errno)
-	}
-	pd.runtimeCtx = ctx
-	return nil
-}
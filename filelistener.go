@@ -0,0 +1,51 @@
+package gotfo
+
+import (
+	"net"
+	"os"
+)
+
+// FileListener returns a listener for the listening TCP socket behind
+// f, such as one passed on by a process handing over to a new one. Fast
+// Open is turned on if fastOpen is set. It is the caller's
+// responsibility to close f when finished; closing the listener does
+// not affect f, and closing f does not affect the listener.
+//
+// The socket of a TFOListener can be handed over in turn with its File
+// method, as with exec.Cmd.ExtraFiles.
+func FileListener(f *os.File, fastOpen bool) (*TFOListener, error) {
+	lc := ListenConfig{FastOpen: fastOpen}
+	return lc.FileListener(f)
+}
+
+// FileListener is like the package function FileListener, but sets up
+// the socket as lc asks for: FastOpen, FastOpenQueueLen and
+// FastOpenKeys are applied to it, and the options for accepted
+// connections to each of them. The socket keeps the backlog, address
+// and SO_REUSEPORT setting it was created with, so Backlog, ReusePort
+// and Control are ignored, except that the Fast Open queue length
+// defaults to Backlog.
+func (lc *ListenConfig) FileListener(f *os.File) (*TFOListener, error) {
+	if err := lc.connOptions().check(); err != nil {
+		return nil, opError("listen", "tcp", nil, nil, err)
+	}
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, err
+	}
+	tl, ok := ln.(*net.TCPListener)
+	if !ok {
+		ln.Close()
+		return nil, opError("listen", ln.Addr().Network(), nil, nil, &net.AddrError{Err: "not a TCP listener", Addr: ln.Addr().String()})
+	}
+
+	rc, err := tl.SyscallConn()
+	if err == nil {
+		err = lc.enableFastOpen(rc, lc.backlog())
+	}
+	if err != nil {
+		tl.Close()
+		return nil, opError("listen", "tcp", nil, tl.Addr().(*net.TCPAddr), err)
+	}
+	return &TFOListener{TCPListener: tl, opts: lc.connOptions()}, nil
+}
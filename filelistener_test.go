@@ -0,0 +1,70 @@
+//go:build unix
+
+package gotfo
+
+import (
+	"io"
+	"net"
+	"testing"
+)
+
+// TestFileListener hands the socket of a listener to FileListener and
+// checks that the new listener serves connections, and that closing it
+// leaves the original open.
+func TestFileListener(t *testing.T) {
+	tl := newTestListener(t)
+	f, err := tl.File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := FileListener(f, true)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Addr().String() != tl.Addr().String() {
+		t.Fatalf("listener on %v, want %v", l.Addr(), tl.Addr())
+	}
+	go serveEcho(l)
+
+	c, err := Dial(tl.Addr().String(), true, []byte("hello"))
+	if err != nil {
+		l.Close()
+		t.Fatal(err)
+	}
+	b := make([]byte, 5)
+	_, err = io.ReadFull(c, b)
+	c.Close()
+	l.Close()
+	if err != nil || string(b) != "hello" {
+		t.Fatalf("read %q, %v, want the data echoed", b, err)
+	}
+
+	go func() {
+		if c, err := net.Dial("tcp", tl.Addr().String()); err == nil {
+			c.Close()
+		}
+	}()
+	sc, err := tl.Accept()
+	if err != nil {
+		t.Fatalf("Accept on the original listener: %v", err)
+	}
+	sc.Close()
+}
+
+func TestFileListenerNotTCP(t *testing.T) {
+	ul, err := net.Listen("unix", t.TempDir()+"/sock")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer ul.Close()
+	f, err := ul.(*net.UnixListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if l, err := FileListener(f, false); err == nil {
+		l.Close()
+		t.Fatal("FileListener took a Unix socket")
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/cbeuw/gotfo
+
+go 1.24
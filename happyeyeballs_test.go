@@ -0,0 +1,118 @@
+package gotfo
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// staticResolver resolves every host to the same addresses.
+type staticResolver []net.IPAddr
+
+func (r staticResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	return r, nil
+}
+
+func TestPartition(t *testing.T) {
+	v4 := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}
+	v6 := &net.TCPAddr{IP: net.IPv6loopback}
+
+	primaries, fallbacks := partition([]*net.TCPAddr{v6, v4, v6, v4})
+	if len(primaries) != 2 || primaries[0] != v6 || primaries[1] != v6 {
+		t.Fatalf("primaries = %v, want the IPv6 addresses", primaries)
+	}
+	if len(fallbacks) != 2 || fallbacks[0] != v4 || fallbacks[1] != v4 {
+		t.Fatalf("fallbacks = %v, want the IPv4 addresses", fallbacks)
+	}
+
+	primaries, fallbacks = partition([]*net.TCPAddr{v4})
+	if len(primaries) != 1 || len(fallbacks) != 0 {
+		t.Fatalf("partition of one address = %v, %v", primaries, fallbacks)
+	}
+}
+
+func TestPartialDeadline(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		deadline time.Time
+		addrs    int
+		want     time.Time
+		wantErr  bool
+	}{
+		// Equal shares of the time left.
+		{now.Add(10 * time.Second), 2, now.Add(5 * time.Second), false},
+		// Shares too short are raised to the sane minimum.
+		{now.Add(3 * time.Second), 3, now.Add(2 * time.Second), false},
+		// But never past the deadline.
+		{now.Add(time.Second), 3, now.Add(time.Second), false},
+		// No deadline.
+		{time.Time{}, 3, time.Time{}, false},
+		// Out of time.
+		{now, 1, time.Time{}, true},
+	}
+	for _, tt := range tests {
+		got, err := partialDeadline(now, tt.deadline, tt.addrs)
+		if (err != nil) != tt.wantErr || !got.Equal(tt.want) {
+			t.Errorf("partialDeadline(%v, %d) = %v, %v, want %v, error %v",
+				tt.deadline.Sub(now), tt.addrs, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// TestDialParallelFallback dials a host whose IPv6 address, tried
+// first, does not answer, and checks that the IPv4 one is dialed after
+// FallbackDelay.
+func TestDialParallelFallback(t *testing.T) {
+	v4 := newTestListener(t)
+	go serveEcho(v4)
+	port := strconv.Itoa(v4.Addr().(*net.TCPAddr).Port)
+	newHangingListener(t, "tcp6", net.JoinHostPort("::1", port))
+
+	const fallbackDelay = 100 * time.Millisecond
+	d := &Dialer{
+		FallbackDelay: fallbackDelay,
+		Timeout:       5 * time.Second,
+		Resolver:      staticResolver{{IP: net.IPv6loopback}, {IP: net.IPv4(127, 0, 0, 1)}},
+	}
+	start := time.Now()
+	c, err := d.Dial("tcp", net.JoinHostPort("dual.test", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	elapsed := time.Since(start)
+
+	if ra := c.RemoteAddr().(*net.TCPAddr); ra.IP.To4() == nil {
+		t.Fatalf("dialed %v, want the IPv4 fallback", ra)
+	}
+	if elapsed < fallbackDelay {
+		t.Fatalf("fallback dialed after %v, before FallbackDelay", elapsed)
+	}
+	if elapsed > 2*time.Second {
+		t.Fatalf("fallback dialed after %v", elapsed)
+	}
+}
+
+// TestDialParallelPrimary checks that a primary address that answers
+// wins without waiting for the fallback.
+func TestDialParallelPrimary(t *testing.T) {
+	v4 := newTestListener(t)
+	go serveEcho(v4)
+	port := strconv.Itoa(v4.Addr().(*net.TCPAddr).Port)
+
+	d := &Dialer{
+		FallbackDelay: time.Hour,
+		Timeout:       5 * time.Second,
+		Resolver:      staticResolver{{IP: net.IPv4(127, 0, 0, 1)}, {IP: net.IPv6loopback}},
+	}
+	c, err := d.Dial("tcp", net.JoinHostPort("dual.test", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if ra := c.RemoteAddr().(*net.TCPAddr); ra.IP.To4() == nil {
+		t.Fatalf("dialed %v, want the IPv4 primary", ra)
+	}
+}
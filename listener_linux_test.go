@@ -0,0 +1,48 @@
+package gotfo
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestAcceptTFO checks what AcceptTFO reports for a plain connect, and,
+// when the system allows it, for one with data in the SYN.
+func TestAcceptTFO(t *testing.T) {
+	ln, err := Listen("127.0.0.1:0", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	l := ln.(*TFOListener)
+
+	accept := func(d *Dialer) *FastOpenInfo {
+		t.Helper()
+		c, err := d.DialContext(WithData(context.Background(), []byte("hello")), "tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		sc, info, err := l.AcceptTFO()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sc.Close()
+		return info
+	}
+
+	info := accept(&Dialer{Timeout: 5 * time.Second})
+	if info.SynData || info.SynBytes != 0 {
+		t.Fatalf("plain connect: %+v, want no SYN data", info)
+	}
+
+	if !serverFastOpenEnabled() {
+		return
+	}
+	d := &Dialer{FastOpen: true, BlackholeCache: &BlackholeCache{}, Timeout: 5 * time.Second}
+	accept(d) // gets a cookie
+	info = accept(d)
+	if !info.SynData || info.SynBytes != 5 {
+		t.Fatalf("Fast Open connect: %+v, want 5 bytes of SYN data", info)
+	}
+}
@@ -0,0 +1,214 @@
+package gotfo
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestListener(t *testing.T) *TFOListener {
+	t.Helper()
+	ln, err := (&ListenConfig{}).Listen(context.Background(), "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	return ln.(*TFOListener)
+}
+
+func TestAcceptContextCanceled(t *testing.T) {
+	l := newTestListener(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	_, err := l.AcceptContext(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("AcceptContext = %v, want context.Canceled", err)
+	}
+	var oe *net.OpError
+	if !errors.As(err, &oe) || oe.Op != "accept" {
+		t.Fatalf("AcceptContext = %v, want an accept *net.OpError", err)
+	}
+
+	// The listener is still open and accepts with no deadline.
+	go func() {
+		if c, err := net.Dial("tcp", l.Addr().String()); err == nil {
+			c.Close()
+		}
+	}()
+	c, err := l.Accept()
+	if err != nil {
+		t.Fatalf("Accept after cancel: %v", err)
+	}
+	c.Close()
+}
+
+func TestAcceptContextDeadline(t *testing.T) {
+	l := newTestListener(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := l.AcceptContext(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) || !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("AcceptContext = %v, want a timeout", err)
+	}
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Fatalf("AcceptContext = %v, want a net.Error with Timeout", err)
+	}
+}
+
+func TestSetDeadline(t *testing.T) {
+	l := newTestListener(t)
+
+	l.SetDeadline(time.Now().Add(20 * time.Millisecond))
+	if _, err := l.Accept(); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Accept = %v, want os.ErrDeadlineExceeded", err)
+	}
+
+	// A deadline set while an AcceptContext is interrupted applies
+	// once the interrupt is over.
+	l.SetDeadline(noDeadline)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	l.AcceptContext(ctx)
+	l.SetDeadline(time.Now().Add(20 * time.Millisecond))
+	start := time.Now()
+	if _, err := l.Accept(); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Accept = %v, want os.ErrDeadlineExceeded", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("Accept took %v to time out", d)
+	}
+}
+
+// TestSetDeadlineEmbedded checks that a deadline set on the embedded
+// net.TCPListener, bypassing TFOListener.SetDeadline, ends Accept.
+func TestSetDeadlineEmbedded(t *testing.T) {
+	l := newTestListener(t)
+
+	l.TCPListener.SetDeadline(aLongTimeAgo)
+	errc := make(chan error, 1)
+	go func() {
+		_, err := l.Accept()
+		errc <- err
+	}()
+	select {
+	case err := <-errc:
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Fatalf("Accept = %v, want os.ErrDeadlineExceeded", err)
+		}
+	case <-time.After(5 * time.Second):
+		l.TCPListener.SetDeadline(noDeadline)
+		l.Close()
+		t.Fatal("Accept did not return after the deadline passed")
+	}
+}
+
+// TestAcceptContextConcurrent runs plain accept loops alongside
+// AcceptContext calls that keep getting canceled. The plain loops must
+// neither fail nor miss connections, and the listener must have no
+// deadline left once all is done.
+func TestAcceptContextConcurrent(t *testing.T) {
+	l := newTestListener(t)
+
+	const (
+		acceptors  = 4
+		cancelers  = 4
+		dials      = 200
+		cancelTime = time.Millisecond
+	)
+
+	var accepted atomic.Int64
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+
+	errc := make(chan error, acceptors)
+	for range acceptors {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				c, err := l.Accept()
+				if err != nil {
+					select {
+					case <-stop:
+					default:
+						errc <- err
+					}
+					return
+				}
+				accepted.Add(1)
+				c.Close()
+			}
+		}()
+	}
+
+	for range cancelers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), cancelTime)
+				c, err := l.AcceptContext(ctx)
+				cancel()
+				if err == nil {
+					accepted.Add(1)
+					c.Close()
+				} else if !errors.Is(err, context.DeadlineExceeded) {
+					select {
+					case <-stop:
+					default:
+						errc <- err
+					}
+					return
+				}
+			}
+		}()
+	}
+
+	for range dials {
+		c, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Close()
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for accepted.Load() < dials {
+		select {
+		case err := <-errc:
+			t.Fatalf("accept: %v", err)
+		default:
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("accepted %d of %d connections", accepted.Load(), dials)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	close(stop)
+	l.Close()
+	wg.Wait()
+	select {
+	case err := <-errc:
+		t.Fatalf("accept: %v", err)
+	default:
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.interrupts != 0 {
+		t.Fatalf("interrupts = %d after all accepts returned", l.interrupts)
+	}
+}
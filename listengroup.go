@@ -0,0 +1,277 @@
+package gotfo
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+var errGroupSize = errors.New("gotfo: a listener group needs at least one listener")
+
+// A ListenerGroup is a set of listeners on the same address, sharing it
+// through SO_REUSEPORT, so that the kernel spreads connections across
+// their accept queues. It is a net.Listener accepting from all of them,
+// and Listeners returns them for accept loops of their own.
+type ListenerGroup struct {
+	listeners []*TFOListener
+
+	startOnce sync.Once
+	closeOnce sync.Once
+	results   chan acceptResult
+	done      chan struct{}
+	stopped   chan struct{}
+
+	// mu guards deadline, and deadlineChanged, which is closed when
+	// SetDeadline replaces the deadline Accept is waiting on.
+	mu              sync.Mutex
+	deadline        time.Time
+	deadlineChanged chan struct{}
+}
+
+type acceptResult struct {
+	c   net.Conn
+	err error
+}
+
+// ListenGroup is like Listen, but opens n listeners on the address with
+// SO_REUSEPORT and Fast Open enabled, as ListenConfig.ListenGroup does.
+func ListenGroup(address string, n int) (*ListenerGroup, error) {
+	lc := ListenConfig{FastOpen: true}
+	return lc.ListenGroup(context.Background(), "tcp", address, n)
+}
+
+// ListenGroup opens n listeners on the local network address, with
+// ReusePort set. If the address has port zero, the first listener picks
+// the port and the others join it. The listeners all get FastOpenKeys,
+// or else share the keys of the network namespace, so that a cookie
+// from any of them is valid on all.
+//
+// With SteerByCPU set, connections are steered to the listener indexed
+// by the CPU that handles them modulo n, which keeps each connection on
+// one CPU when an accept loop runs on each.
+func (lc *ListenConfig) ListenGroup(ctx context.Context, network, address string, n int) (*ListenerGroup, error) {
+	if n < 1 {
+		return nil, opError("listen", network, nil, nil, errGroupSize)
+	}
+	laddr, err := net.ResolveTCPAddr(network, address)
+	if err != nil {
+		return nil, opError("listen", network, nil, nil, err)
+	}
+	if err := lc.connOptions().check(); err != nil {
+		return nil, opError("listen", network, nil, laddr, err)
+	}
+
+	glc := *lc
+	glc.ReusePort = true
+	g := &ListenerGroup{
+		results: make(chan acceptResult),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	for i := 0; i < n; i++ {
+		ln, err := glc.listenTCP(ctx, network, laddr)
+		if err != nil {
+			g.closeListeners()
+			return nil, opError("listen", network, nil, laddr, err)
+		}
+		l := ln.(*TFOListener)
+		g.listeners = append(g.listeners, l)
+		if i == 0 {
+			a := *l.Addr().(*net.TCPAddr)
+			laddr = &a
+		}
+	}
+
+	if lc.SteerByCPU {
+		rc, err := g.listeners[0].SyscallConn()
+		if err == nil {
+			err = attachReusePortCPU(rc, n)
+		}
+		if err != nil {
+			g.closeListeners()
+			return nil, opError("listen", network, nil, laddr, err)
+		}
+	}
+	return g, nil
+}
+
+// Listeners returns the listeners of the group, in the order the
+// kernel indexes them in.
+func (g *ListenerGroup) Listeners() []*TFOListener {
+	return g.listeners
+}
+
+// Accept waits for and returns the next connection on any of the
+// listeners. Once it has been called, the group accepts from every
+// listener, and so should not be mixed with accept loops on Listeners.
+func (g *ListenerGroup) Accept() (net.Conn, error) {
+	return g.AcceptContext(context.Background())
+}
+
+// AcceptContext is like Accept, but gives up when ctx is done. The
+// listeners stay open, and a connection accepted meanwhile is kept for
+// the next call; the error then wraps that of ctx.
+func (g *ListenerGroup) AcceptContext(ctx context.Context) (net.Conn, error) {
+	g.startOnce.Do(g.startAccepting)
+
+	for {
+		g.mu.Lock()
+		if g.deadlineChanged == nil {
+			g.deadlineChanged = make(chan struct{})
+		}
+		deadline, changed := g.deadline, g.deadlineChanged
+		g.mu.Unlock()
+
+		var timer *time.Timer
+		var expired <-chan time.Time
+		if !deadline.IsZero() {
+			timer = time.NewTimer(time.Until(deadline))
+			expired = timer.C
+		}
+
+		var r acceptResult
+		changedDeadline := false
+		select {
+		case r = <-g.results:
+		case <-g.done:
+			r.err = g.acceptError(net.ErrClosed)
+		case <-g.stopped:
+			// Every listener was closed on its own.
+			r.err = g.acceptError(net.ErrClosed)
+		case <-ctx.Done():
+			r.err = g.acceptError(mapErr(ctx.Err()))
+		case <-expired:
+			r.err = g.acceptError(errTimeout)
+		case <-changed:
+			// Wait again with the new deadline.
+			changedDeadline = true
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if !changedDeadline {
+			return r.c, r.err
+		}
+	}
+}
+
+// SetDeadline sets the deadline for Accept and AcceptContext on the
+// group, including calls already blocked. A zero value means Accept
+// will not time out. It does not apply to the listeners themselves.
+func (g *ListenerGroup) SetDeadline(t time.Time) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.deadline = t
+	if g.deadlineChanged != nil {
+		close(g.deadlineChanged)
+		g.deadlineChanged = nil
+	}
+	return nil
+}
+
+func (g *ListenerGroup) acceptError(err error) error {
+	return opError("accept", "tcp", nil, g.Addr().(*net.TCPAddr), err)
+}
+
+// startAccepting starts an accept loop for each listener, handing its
+// connections to Accept. Once all loops have stopped, stopped is closed.
+func (g *ListenerGroup) startAccepting() {
+	var loops sync.WaitGroup
+	for _, l := range g.listeners {
+		loops.Add(1)
+		go func() {
+			defer loops.Done()
+			g.acceptLoop(l)
+		}()
+	}
+	go func() {
+		loops.Wait()
+		close(g.stopped)
+	}()
+}
+
+// acceptLoop accepts connections on l and hands them to Accept until l
+// is closed. Like Server.Serve, it retries temporary errors, such as
+// running out of file descriptors, after a delay, so that the kernel
+// does not keep steering connections to a listener nobody accepts on.
+// Other errors are passed on, and then retried in the same way. The
+// closing of l is not passed on, as the other listeners may still be
+// open; Accept reports it once every loop has stopped.
+func (g *ListenerGroup) acceptLoop(l net.Listener) {
+	var tempDelay time.Duration // how long to sleep on accept failure
+	for {
+		c, err := l.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err == nil {
+			tempDelay = 0
+		} else {
+			if tempDelay == 0 {
+				tempDelay = 5 * time.Millisecond
+			} else {
+				tempDelay *= 2
+			}
+			if max := 1 * time.Second; tempDelay > max {
+				tempDelay = max
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				if !g.sleep(tempDelay) {
+					return
+				}
+				continue
+			}
+		}
+
+		select {
+		case g.results <- acceptResult{c, err}:
+		case <-g.done:
+			if c != nil {
+				c.Close()
+			}
+			return
+		}
+		if err != nil && !g.sleep(tempDelay) {
+			return
+		}
+	}
+}
+
+// sleep waits for d, and reports false if the group is closed first.
+func (g *ListenerGroup) sleep(d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-g.done:
+		return false
+	}
+}
+
+// Close closes every listener of the group.
+func (g *ListenerGroup) Close() error {
+	err := net.ErrClosed
+	g.closeOnce.Do(func() {
+		close(g.done)
+		err = g.closeListeners()
+	})
+	return err
+}
+
+func (g *ListenerGroup) closeListeners() error {
+	var firstErr error
+	for _, l := range g.listeners {
+		if err := l.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Addr returns the address the group listens on.
+func (g *ListenerGroup) Addr() net.Addr {
+	return g.listeners[0].Addr()
+}
@@ -0,0 +1,201 @@
+package gotfo
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func newTestGroup(t *testing.T, n int) *ListenerGroup {
+	t.Helper()
+	g, err := (&ListenConfig{}).ListenGroup(context.Background(), "tcp", "127.0.0.1:0", n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { g.Close() })
+	return g
+}
+
+func TestListenerGroupAccept(t *testing.T) {
+	for _, steer := range []bool{false, true} {
+		lc := &ListenConfig{SteerByCPU: steer}
+		g, err := lc.ListenGroup(context.Background(), "tcp", "127.0.0.1:0", 4)
+		if err != nil {
+			if steer {
+				t.Logf("SteerByCPU: %v", err)
+				continue
+			}
+			t.Fatal(err)
+		}
+
+		ls := g.Listeners()
+		if len(ls) != 4 {
+			t.Fatalf("%d listeners, want 4", len(ls))
+		}
+		for _, l := range ls {
+			if l.Addr().String() != g.Addr().String() {
+				t.Fatalf("listener on %v, want %v", l.Addr(), g.Addr())
+			}
+		}
+
+		const dials = 64
+		errc := make(chan error, 1)
+		go func() {
+			for range dials {
+				c, err := net.Dial("tcp", g.Addr().String())
+				if err != nil {
+					errc <- err
+					return
+				}
+				c.Close()
+			}
+			errc <- nil
+		}()
+		for i := range dials {
+			c, err := g.Accept()
+			if err != nil {
+				t.Fatalf("SteerByCPU %v: Accept %d: %v", steer, i, err)
+			}
+			c.Close()
+		}
+		if err := <-errc; err != nil {
+			t.Fatal(err)
+		}
+
+		if err := g.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := g.Accept(); !errors.Is(err, net.ErrClosed) {
+			t.Fatalf("Accept after Close = %v, want net.ErrClosed", err)
+		}
+	}
+}
+
+func TestListenerGroupSize(t *testing.T) {
+	if _, err := ListenGroup("127.0.0.1:0", 0); !errors.Is(err, errGroupSize) {
+		t.Fatalf("ListenGroup with no listeners = %v, want errGroupSize", err)
+	}
+}
+
+func TestListenerGroupSetDeadline(t *testing.T) {
+	g := newTestGroup(t, 2)
+
+	// A deadline set while Accept is blocked applies to it.
+	time.AfterFunc(20*time.Millisecond, func() {
+		g.SetDeadline(time.Now().Add(20 * time.Millisecond))
+	})
+	if _, err := g.Accept(); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Accept = %v, want os.ErrDeadlineExceeded", err)
+	}
+
+	// Moving the deadline out many times does not end the wait.
+	g.SetDeadline(noDeadline)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 100 {
+			g.SetDeadline(time.Now().Add(time.Hour))
+		}
+		g.SetDeadline(noDeadline)
+		if c, err := net.Dial("tcp", g.Addr().String()); err == nil {
+			c.Close()
+		}
+	}()
+	c, err := g.Accept()
+	if err != nil {
+		t.Fatalf("Accept = %v", err)
+	}
+	c.Close()
+	<-done
+}
+
+func TestListenerGroupAcceptContext(t *testing.T) {
+	g := newTestGroup(t, 2)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if _, err := g.AcceptContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("AcceptContext = %v, want context.Canceled", err)
+	}
+
+	go func() {
+		if c, err := net.Dial("tcp", g.Addr().String()); err == nil {
+			c.Close()
+		}
+	}()
+	c, err := g.AcceptContext(context.Background())
+	if err != nil {
+		t.Fatalf("AcceptContext after cancel: %v", err)
+	}
+	c.Close()
+}
+
+// flakyListener fails its first accepts with a temporary error, as when
+// the process is out of file descriptors.
+type flakyListener struct {
+	net.Listener
+	failures int
+}
+
+func (l *flakyListener) Accept() (net.Conn, error) {
+	if l.failures > 0 {
+		l.failures--
+		return nil, &net.OpError{Op: "accept", Net: "tcp", Err: os.NewSyscallError("accept", syscall.EMFILE)}
+	}
+	return l.Listener.Accept()
+}
+
+func TestListenerGroupRetriesTemporaryErrors(t *testing.T) {
+	g := newTestGroup(t, 1)
+	g.startOnce.Do(func() {
+		go g.acceptLoop(&flakyListener{Listener: g.listeners[0], failures: 3})
+	})
+
+	go func() {
+		if c, err := net.Dial("tcp", g.Addr().String()); err == nil {
+			c.Close()
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, err := g.AcceptContext(ctx)
+	if err != nil {
+		t.Fatalf("AcceptContext = %v, want the connection after the temporary errors", err)
+	}
+	c.Close()
+}
+
+// TestListenerGroupListenersClosed checks that the group keeps accepting
+// on the other listeners when one is closed on its own, and reports
+// net.ErrClosed once they all are.
+func TestListenerGroupListenersClosed(t *testing.T) {
+	g := newTestGroup(t, 2)
+	ls := g.Listeners()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ls[0].Close()
+	go func() {
+		if c, err := net.Dial("tcp", g.Addr().String()); err == nil {
+			c.Close()
+		}
+	}()
+	c, err := g.AcceptContext(ctx)
+	if err != nil {
+		t.Fatalf("AcceptContext with one listener closed = %v", err)
+	}
+	c.Close()
+
+	ls[1].Close()
+	_, err = g.AcceptContext(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("AcceptContext blocked after every listener was closed")
+	}
+	if !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("AcceptContext = %v, want net.ErrClosed", err)
+	}
+}
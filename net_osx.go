@@ -1,128 +1,80 @@
-// +build darwin
+//go:build darwin
 
 package gotfo
 
 // OSX doesn't have enum SOL_TCP and MSG_FASTOPEN
 
-import (
-	"context"
-	"net"
-	"syscall"
-)
 import (
 	"os"
+	"syscall"
 )
 
 const (
-	TCP_FASTOPEN   = 23
+	TCP_FASTOPEN = 23
+	msgFastOpen  = 0x20000000
+	soReusePort  = 0x200
+
+	// Deprecated: listeners use ListenConfig.Backlog, which defaults
+	// to syscall.SOMAXCONN.
 	LISTEN_BACKLOG = 23
 )
 
-type TFOListener struct {
-	*net.TCPListener
-	fd *netFD
-}
-
-func socket(family int, fastOpen bool) (int, error) {
+func socket(family int, ipv6only bool, fastOpen bool) (int, error) {
+	syscall.ForkLock.RLock()
 	fd, err := syscall.Socket(family, syscall.SOCK_STREAM, 0)
-	if err != nil {
-		return 0, err
-	}
-	if fastOpen {
-		if err := syscall.SetsockoptInt(fd, syscall.IPPROTO_TCP, TCP_FASTOPEN, 1); err != nil {
-			return 0, err
-		}
+	if err == nil {
+		syscall.CloseOnExec(fd)
 	}
-
-	if err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1); err != nil {
-		return 0, err
-	}
-
-	return fd, nil
-}
-
-func Listen(address string, fastOpen bool) (net.Listener, error) {
-	laddr, err := net.ResolveTCPAddr("tcp", address)
+	syscall.ForkLock.RUnlock()
 	if err != nil {
-		return nil, err
+		return -1, os.NewSyscallError("socket", err)
 	}
 
-	fd, err := socket(syscall.AF_INET, fastOpen)
-	if err != nil {
+	if err := syscall.SetNonblock(fd, true); err != nil {
 		syscall.Close(fd)
-		return nil, err
+		return -1, os.NewSyscallError("setnonblock", err)
 	}
 
-	sa := tcpAddrToSockaddr(laddr)
-
-	if err := syscall.Bind(fd, sa); err != nil {
-		syscall.Close(fd)
-		return nil, err
+	if family == syscall.AF_INET6 {
+		v6only := 0
+		if ipv6only {
+			v6only = 1
+		}
+		if err := syscall.SetsockoptInt(fd, syscall.IPPROTO_IPV6, syscall.IPV6_V6ONLY, v6only); err != nil {
+			syscall.Close(fd)
+			return -1, os.NewSyscallError("setsockopt", err)
+		}
 	}
 
-	if err := syscall.Listen(fd, LISTEN_BACKLOG); err != nil {
-		syscall.Close(fd)
-		return nil, err
+	if fastOpen {
+		if err := syscall.SetsockoptInt(fd, syscall.IPPROTO_TCP, TCP_FASTOPEN, 1); err != nil {
+			syscall.Close(fd)
+			return -1, fastOpenSyscallError("setsockopt", err)
+		}
 	}
 
-	nfd := newFD(fd)
-	if err := nfd.init(); err != nil {
+	if err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1); err != nil {
 		syscall.Close(fd)
-		return nil, err
+		return -1, os.NewSyscallError("setsockopt", err)
 	}
 
-	return newTCPListener(nfd, false), nil
+	return fd, nil
 }
 
-func Dial(address string, fastOpen bool, data []byte) (*net.TCPConn, error) {
-	return DialContext(context.Background(), address, fastOpen, data)
+// setFastOpenQueue enables Fast Open on a listening socket. The Darwin
+// option is a flag rather than a queue length, so qlen is ignored.
+func setFastOpenQueue(fd, qlen int) error {
+	return syscall.SetsockoptInt(fd, syscall.IPPROTO_TCP, TCP_FASTOPEN, 1)
 }
 
-var fdCallback func(int)
-
-func SetFdCallback(fn func(int)) {
-	fdCallback = fn
+// setFastOpenConnect fails, as there is no TCP_FASTOPEN_CONNECT outside
+// Linux.
+func setFastOpenConnect(fd int) error {
+	return syscall.ENOPROTOOPT
 }
 
-func DialContext(ctx context.Context, address string, fastOpen bool, data []byte) (*net.TCPConn, error) {
-	raddr, err := net.ResolveTCPAddr("tcp", address)
-	if err != nil {
-		return nil, err
-	}
-
-	fd, err := socket(syscall.AF_INET, fastOpen)
-	if err != nil {
-		syscall.Close(fd)
-		return nil, err
-	}
-
-	sa := tcpAddrToSockaddr(raddr)
-
-	nfd := newFD(fd)
-	if err := nfd.init(); err != nil {
-		syscall.Close(fd)
-		return nil, err
-	}
-
-	if fdCallback != nil {
-		fdCallback(nfd.sysfd)
-	}
-
-	for {
-		if fastOpen {
-			err = syscall.Sendto(nfd.sysfd, data, 0x20000000, sa)
-		} else {
-			err = syscall.Connect(nfd.sysfd, sa)
-		}
-		if err == syscall.EAGAIN {
-			continue
-		}
-		break
-	}
-
-	if _, ok := err.(syscall.Errno); ok {
-		err = os.NewSyscallError("sendto", err)
-	}
-
-	return newTCPConn(nfd), err
+// setBindAddressNoPort does nothing, as there is no
+// IP_BIND_ADDRESS_NO_PORT outside Linux.
+func setBindAddressNoPort(fd int) error {
+	return nil
 }
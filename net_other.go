@@ -0,0 +1,44 @@
+//go:build !darwin && !linux && !windows
+
+package gotfo
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"runtime"
+	"syscall"
+)
+
+var errUnsupported = fmt.Errorf("%w on %s", ErrFastOpenUnsupported, runtime.GOOS)
+
+const clientFastOpen = false
+
+type dialSocket struct {
+	fastOpenConnect bool
+	synBytes        int
+}
+
+func (d *Dialer) newDialSocket(ctx context.Context, network string, laddr, raddr *net.TCPAddr) (*dialSocket, error) {
+	return nil, errUnsupported
+}
+
+func (s *dialSocket) connect(ctx context.Context, data []byte, fastOpen bool) (*net.TCPConn, error) {
+	return nil, errUnsupported
+}
+
+func (s *dialSocket) close() error {
+	return nil
+}
+
+func fastOpenErrnoKind(errno syscall.Errno) error {
+	return nil
+}
+
+func (lc *ListenConfig) enableFastOpen(rc syscall.RawConn, backlog int) error {
+	return errUnsupported
+}
+
+func (lc *ListenConfig) listenTCP(ctx context.Context, network string, laddr *net.TCPAddr) (net.Listener, error) {
+	return nil, errUnsupported
+}
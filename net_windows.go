@@ -1,77 +1,148 @@
-// Copyright 2009 The Go Authors. All rights reserved.
-// Use of this source code is governed by a BSD-style
-// license that can be found in the LICENSE file.
-
 package gotfo
 
 import (
 	"context"
+	"errors"
 	"net"
+	"os"
 	"syscall"
 )
 
 const TCP_FASTOPEN = 15
 
-func init() {
-	sysInit()
+// clientFastOpen is false, as dials never send data in the SYN; see
+// Dialer.FastOpen.
+const clientFastOpen = false
+
+// Winsock errors that the syscall package has no names for.
+const (
+	wsaENOPROTOOPT syscall.Errno = 10042
+	wsaEOPNOTSUPP  syscall.Errno = 10045
+)
+
+// fastOpenControl returns a net.Dialer or net.ListenConfig Control
+// function that turns on Fast Open if asked to before running fn.
+func fastOpenControl(fastOpen bool, fn func(network, address string, c syscall.RawConn) error) func(string, string, syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		if fastOpen {
+			var err error
+			if cerr := c.Control(func(fd uintptr) {
+				err = syscall.SetsockoptInt(syscall.Handle(fd), syscall.IPPROTO_TCP, TCP_FASTOPEN, 1)
+			}); cerr != nil {
+				return cerr
+			}
+			if err != nil {
+				return fastOpenSyscallError("setsockopt", err)
+			}
+		}
+		if fn != nil {
+			return fn(network, address, c)
+		}
+		return nil
+	}
 }
 
-type TFOListener struct {
-	*net.TCPListener
-	fd *netFD
+// fastOpenErrnoKind returns ErrFastOpenUnsupported if errno is how
+// Windows refuses Fast Open, or nil. Versions before Windows 10 1607 do
+// not know TCP_FASTOPEN, and there is no TCP_FASTOPEN_CONNECT.
+func fastOpenErrnoKind(errno syscall.Errno) error {
+	switch errno {
+	case syscall.EWINDOWS, syscall.ENOPROTOOPT, wsaENOPROTOOPT, wsaEOPNOTSUPP:
+		return ErrFastOpenUnsupported
+	}
+	return nil
 }
 
-func (ln *TFOListener) ok() bool { return ln != nil && ln.fd != nil }
+// dialSocket holds what is needed to dial an address. The net package
+// creates the socket as it dials, so there is nothing to set up before.
+type dialSocket struct {
+	d            *Dialer
+	network      string
+	laddr, raddr *net.TCPAddr
 
-func (ln *TFOListener) accept() (*net.TCPConn, error) {
-	fd, err := ln.fd.accept()
-	if err != nil {
-		return nil, err
+	// fastOpenConnect is always false, as there is no
+	// TCP_FASTOPEN_CONNECT.
+	fastOpenConnect bool
+
+	// synBytes is always zero, as the data never goes in the SYN.
+	synBytes int
+}
+
+func (d *Dialer) newDialSocket(ctx context.Context, network string, laddr, raddr *net.TCPAddr) (*dialSocket, error) {
+	if d.FastOpenConnect {
+		return nil, fastOpenSyscallError("setsockopt", syscall.EWINDOWS)
 	}
-	return newTCPConn(fd), nil
+	return &dialSocket{d: d, network: network, laddr: laddr, raddr: raddr}, nil
 }
 
-func (l *TFOListener) AcceptTCP() (*net.TCPConn, error) {
-	if !l.ok() {
-		return nil, syscall.EINVAL
+// connect dials with the net package, which calls ConnectEx without a
+// buffer. The data therefore follows the handshake rather than riding
+// in the SYN, as Dialer.FastOpen documents, but the socket still takes
+// part in Fast Open cookie exchange.
+func (s *dialSocket) connect(ctx context.Context, data []byte, fastOpen bool) (*net.TCPConn, error) {
+	control := func(network, address string, c syscall.RawConn) error {
+		return s.d.control(ctx, network, address, c)
 	}
-	c, err := l.accept()
+	nd := net.Dialer{
+		KeepAlive: -1,
+		Control:   fastOpenControl(fastOpen, control),
+	}
+	if s.laddr != nil {
+		nd.LocalAddr = s.laddr
+	}
+
+	nc, err := nd.DialContext(ctx, s.network, s.raddr.String())
 	if err != nil {
-		return nil, &net.OpError{Op: "accept", Net: l.fd.net, Source: nil, Addr: l.fd.laddr, Err: err}
+		return nil, err
+	}
+	c := nc.(*net.TCPConn)
+
+	if len(data) > 0 {
+		if deadline, ok := ctx.Deadline(); ok {
+			c.SetWriteDeadline(deadline)
+			defer c.SetWriteDeadline(noDeadline)
+		}
+		if _, err := c.Write(data); err != nil {
+			c.Close()
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				return nil, errTimeout
+			}
+			return nil, err
+		}
 	}
 	return c, nil
 }
 
-func (l *TFOListener) Accept() (net.Conn, error) {
-	return l.AcceptTCP()
+func (s *dialSocket) close() error {
+	return nil
 }
 
-func Dial(address string, fastOpen bool, data []byte) (*net.TCPConn, error) {
-	return DialContext(context.Background(), address, fastOpen, data)
+// enableFastOpen turns on Fast Open on the listening socket behind rc if
+// lc asks for it. Windows takes no queue length, so backlog is ignored.
+func (lc *ListenConfig) enableFastOpen(rc syscall.RawConn, backlog int) error {
+	if len(lc.FastOpenKeys) > 0 {
+		return fastOpenSyscallError("setsockopt", syscall.EWINDOWS)
+	}
+	return fastOpenControl(lc.FastOpen, nil)("", "", rc)
 }
 
-func DialContext(ctx context.Context, address string, fastOpen bool, data []byte) (*net.TCPConn, error) {
-	raddr, err := net.ResolveTCPAddr("tcp", address)
-	if err != nil {
-		return nil, err
+// listenTCP listens with the net package, which always passes
+// syscall.SOMAXCONN to listen, so Backlog is ignored, as
+// ListenConfig.Backlog documents.
+func (lc *ListenConfig) listenTCP(ctx context.Context, network string, laddr *net.TCPAddr) (net.Listener, error) {
+	if lc.ReusePort {
+		return nil, os.NewSyscallError("setsockopt", syscall.EWINDOWS)
 	}
-
-	if fd, err := socket(ctx, syscall.AF_INET, false, raddr, true, fastOpen, data); err != nil {
-		return nil, err
-	} else {
-		return newTCPConn(fd), nil
+	if len(lc.FastOpenKeys) > 0 {
+		return nil, fastOpenSyscallError("setsockopt", syscall.EWINDOWS)
 	}
-}
 
-func Listen(address string, fastOpen bool) (net.Listener, error) {
-	laddr, err := net.ResolveTCPAddr("tcp", address)
-	if err != nil {
-		return nil, err
+	nlc := net.ListenConfig{
+		Control: fastOpenControl(lc.FastOpen, lc.Control),
 	}
-
-	if fd, err := socket(context.Background(), syscall.AF_INET, false, laddr, false, fastOpen, nil); err != nil {
+	ln, err := nlc.Listen(ctx, network, laddr.String())
+	if err != nil {
 		return nil, err
-	} else {
-		return newTCPListener(fd, true), nil
 	}
+	return &TFOListener{TCPListener: ln.(*net.TCPListener), opts: lc.connOptions()}, nil
 }
@@ -0,0 +1,430 @@
+package gotfo
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrServerClosed is returned by Server.Serve after a call to Shutdown
+// or Close.
+var ErrServerClosed = errors.New("gotfo: Server closed")
+
+// A ConnState is the state of a connection of a Server. It is used by
+// the Server.ConnState hook.
+type ConnState int
+
+const (
+	// StateNew is a connection that has just been accepted, before
+	// the handler moved any data on it. Shutdown takes one that has
+	// stayed new for 5 seconds for idle.
+	StateNew ConnState = iota
+	// StateActive is a connection that has read or written data
+	// since it was new or idle.
+	StateActive
+	// StateIdle is a connection that its handler marked idle with
+	// ServerConn.SetIdle, as between requests. Shutdown closes idle
+	// connections at once.
+	StateIdle
+	// StateClosed is a connection whose handler has returned, after
+	// which it was closed. It is a terminal state.
+	StateClosed
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case StateNew:
+		return "new"
+	case StateActive:
+		return "active"
+	case StateIdle:
+		return "idle"
+	case StateClosed:
+		return "closed"
+	}
+	return "unknown"
+}
+
+// A Server serves the connections accepted on its listeners, keeping
+// track of them so that it can shut down gracefully. It works like
+// http.Server, but for raw TCP.
+type Server struct {
+	// Handler serves a connection. The connection is closed when it
+	// returns.
+	Handler func(c *ServerConn)
+
+	// ConnState, if not nil, is called when a connection changes
+	// state.
+	ConnState func(c *ServerConn, state ConnState)
+
+	inShutdown atomic.Bool
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[*ServerConn]struct{}
+}
+
+// newConnIdleTimeout is how long a connection may stay new, without
+// moving any data, before Shutdown takes it for idle, as http.Server
+// does. It is a variable for tests.
+var newConnIdleTimeout = 5 * time.Second
+
+// A ServerConn is a connection of a Server. Reads and writes that move
+// data make it active, and its handler marks it idle.
+type ServerConn struct {
+	net.Conn
+	srv *Server
+
+	// mu guards the fields below. To close an idle connection that a
+	// Read is blocked on, Shutdown sets a read deadline in the past
+	// rather than closing it under the Read, which may be returning
+	// data that just came in. The Read then keeps the connection if it
+	// got data, or closes it.
+	mu           sync.Mutex
+	state        ConnState
+	since        time.Time // when the connection was accepted
+	reading      int       // Reads in progress
+	closing      bool      // Shutdown has interrupted the Reads
+	closed       bool      // Shutdown has closed the connection
+	readDeadline time.Time // the read deadline set by the handler
+}
+
+// Read reads data from the connection, making it active if it is not.
+func (c *ServerConn) Read(b []byte) (int, error) {
+	c.mu.Lock()
+	c.reading++
+	c.mu.Unlock()
+
+	n, err := c.Conn.Read(b)
+
+	c.mu.Lock()
+	c.reading--
+	if c.closing {
+		if n > 0 {
+			// The data came in as Shutdown was closing the
+			// connection, which is no longer idle then.
+			c.closing = false
+			c.Conn.SetReadDeadline(c.readDeadline)
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				err = nil
+			}
+		} else {
+			if c.reading == 0 {
+				c.closeIdleLocked()
+			}
+			err = c.closedError("read")
+		}
+	}
+	changed := n > 0 && c.setStateLocked(StateActive)
+	c.mu.Unlock()
+	if changed {
+		c.srv.connState(c, StateActive)
+	}
+	return n, err
+}
+
+// Write writes data to the connection, making it active if it is not.
+// It fails if Shutdown has taken the connection for idle and is closing
+// it.
+func (c *ServerConn) Write(b []byte) (int, error) {
+	if len(b) > 0 {
+		c.mu.Lock()
+		if c.closing || c.closed {
+			c.mu.Unlock()
+			return 0, c.closedError("write")
+		}
+		changed := c.setStateLocked(StateActive)
+		c.mu.Unlock()
+		if changed {
+			c.srv.connState(c, StateActive)
+		}
+	}
+	return c.Conn.Write(b)
+}
+
+// SetDeadline sets the read and write deadlines of the connection.
+func (c *ServerConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	if c.closing {
+		// The read deadline is set back when the Read returns.
+		return c.Conn.SetWriteDeadline(t)
+	}
+	return c.Conn.SetDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline of the connection.
+func (c *ServerConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	if c.closing {
+		return nil
+	}
+	return c.Conn.SetReadDeadline(t)
+}
+
+// SetIdle marks the connection idle, as between requests, so that
+// Shutdown may close it without cutting off any work.
+func (c *ServerConn) SetIdle() {
+	c.setState(StateIdle)
+}
+
+// State returns the state of the connection.
+func (c *ServerConn) State() ConnState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+func (c *ServerConn) setState(state ConnState) {
+	c.mu.Lock()
+	changed := c.setStateLocked(state)
+	c.mu.Unlock()
+	if changed {
+		c.srv.connState(c, state)
+	}
+}
+
+// setStateLocked sets the state of the connection, and reports whether
+// it changed, in which case the caller calls the ConnState hook once it
+// has released mu.
+func (c *ServerConn) setStateLocked(state ConnState) bool {
+	if c.state == state || c.state == StateClosed {
+		return false
+	}
+	c.state = state
+	return true
+}
+
+// closeIfIdle closes the connection if it is idle, or has been new for
+// newConnIdleTimeout, holding the lock so that it does not become
+// active meanwhile. It reports whether the connection is closed. If a
+// Read is in progress, it interrupts the Read instead, which closes the
+// connection unless data came in.
+func (c *ServerConn) closeIfIdle(now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch {
+	case c.closed:
+		return true
+	case c.closing:
+		return false
+	case c.state == StateIdle:
+	case c.state == StateNew && now.Sub(c.since) >= newConnIdleTimeout:
+	default:
+		return false
+	}
+	if c.reading == 0 {
+		c.closeIdleLocked()
+		return true
+	}
+	c.closing = true
+	c.Conn.SetReadDeadline(aLongTimeAgo)
+	return false
+}
+
+func (c *ServerConn) closeIdleLocked() {
+	c.closing = false
+	c.closed = true
+	c.Conn.Close()
+}
+
+func (c *ServerConn) closedError(op string) error {
+	return &net.OpError{Op: op, Net: "tcp", Source: c.LocalAddr(), Addr: c.RemoteAddr(), Err: net.ErrClosed}
+}
+
+// Serve accepts connections on l and serves each with Handler in a
+// goroutine of its own. It always returns a non-nil error, and closes
+// l. After Shutdown or Close, the error is ErrServerClosed.
+func (s *Server) Serve(l net.Listener) error {
+	if !s.trackListener(l, true) {
+		l.Close()
+		return ErrServerClosed
+	}
+	defer s.trackListener(l, false)
+	defer l.Close()
+
+	var tempDelay time.Duration // how long to sleep on accept failure
+	for {
+		rw, err := l.Accept()
+		if err != nil {
+			if s.inShutdown.Load() {
+				return ErrServerClosed
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				if tempDelay == 0 {
+					tempDelay = 5 * time.Millisecond
+				} else {
+					tempDelay *= 2
+				}
+				if max := 1 * time.Second; tempDelay > max {
+					tempDelay = max
+				}
+				time.Sleep(tempDelay)
+				continue
+			}
+			return err
+		}
+		tempDelay = 0
+
+		c := &ServerConn{Conn: rw, srv: s, state: StateNew, since: time.Now()}
+		if !s.trackConn(c, true) {
+			rw.Close()
+			return ErrServerClosed
+		}
+		s.connState(c, StateNew)
+		go s.serveConn(c)
+	}
+}
+
+func (s *Server) connState(c *ServerConn, state ConnState) {
+	if hook := s.ConnState; hook != nil {
+		hook(c, state)
+	}
+}
+
+func (s *Server) serveConn(c *ServerConn) {
+	defer func() {
+		c.Conn.Close()
+		c.setState(StateClosed)
+		s.trackConn(c, false)
+	}()
+	if s.Handler != nil {
+		s.Handler(c)
+	}
+}
+
+// trackListener adds or removes l from the listeners of s. It does not
+// add l, and reports false, once s is shutting down.
+func (s *Server) trackListener(l net.Listener, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !add {
+		delete(s.listeners, l)
+		return true
+	}
+	if s.inShutdown.Load() {
+		return false
+	}
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]struct{})
+	}
+	s.listeners[l] = struct{}{}
+	return true
+}
+
+// trackConn adds or removes c from the connections of s. It does not
+// add c, and reports false, once s is shutting down.
+func (s *Server) trackConn(c *ServerConn, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !add {
+		delete(s.conns, c)
+		return true
+	}
+	if s.inShutdown.Load() {
+		return false
+	}
+	if s.conns == nil {
+		s.conns = make(map[*ServerConn]struct{})
+	}
+	s.conns[c] = struct{}{}
+	return true
+}
+
+// shutdownPollIntervalMax is the longest Shutdown waits between checks
+// for connections that have become idle or closed.
+const shutdownPollIntervalMax = 500 * time.Millisecond
+
+// Shutdown shuts the server down gracefully: it closes all listeners,
+// then closes connections as they become idle, or once they have been
+// new for 5 seconds, and waits for the others to be closed by their
+// handlers. If ctx is done first, the remaining connections are closed
+// forcibly, and Shutdown returns the error of ctx without waiting for
+// their handlers to return, as http.Server does. Otherwise it returns
+// the error from closing the listeners, if any.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.inShutdown.Store(true)
+
+	s.mu.Lock()
+	lnerr := s.closeListenersLocked()
+	s.mu.Unlock()
+
+	pollIntervalBase := time.Millisecond
+	nextPollInterval := func() time.Duration {
+		// Add 10% jitter.
+		interval := pollIntervalBase + time.Duration(time.Now().UnixNano()%int64(pollIntervalBase/10+1))
+		// Double and clamp for next time.
+		pollIntervalBase *= 2
+		if pollIntervalBase > shutdownPollIntervalMax {
+			pollIntervalBase = shutdownPollIntervalMax
+		}
+		return interval
+	}
+
+	timer := time.NewTimer(nextPollInterval())
+	defer timer.Stop()
+	for {
+		if s.closeIdleConns() {
+			return lnerr
+		}
+		select {
+		case <-ctx.Done():
+			s.closeConns()
+			return ctx.Err()
+		case <-timer.C:
+			timer.Reset(nextPollInterval())
+		}
+	}
+}
+
+// Close closes all listeners and connections at once. It does not wait
+// for handlers to return. It returns the error from closing the
+// listeners, if any.
+func (s *Server) Close() error {
+	s.inShutdown.Store(true)
+	s.mu.Lock()
+	err := s.closeListenersLocked()
+	s.mu.Unlock()
+	s.closeConns()
+	return err
+}
+
+func (s *Server) closeListenersLocked() error {
+	var err error
+	for l := range s.listeners {
+		if cerr := l.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// closeIdleConns closes idle connections, and reports whether none are
+// left open.
+func (s *Server) closeIdleConns() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	quiescent := true
+	now := time.Now()
+	for c := range s.conns {
+		if !c.closeIfIdle(now) {
+			quiescent = false
+		}
+	}
+	return quiescent
+}
+
+func (s *Server) closeConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.conns {
+		c.Conn.Close()
+	}
+}
@@ -0,0 +1,273 @@
+package gotfo
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// startTestServer serves srv on a loopback listener, and returns the
+// address it listens on.
+func startTestServer(t *testing.T, srv *Server) string {
+	t.Helper()
+	l := newTestListener(t)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		srv.Serve(l)
+	}()
+	t.Cleanup(func() {
+		srv.Close()
+		<-done
+	})
+	return l.Addr().String()
+}
+
+func TestShutdownClosesNewConns(t *testing.T) {
+	defer func(d time.Duration) { newConnIdleTimeout = d }(newConnIdleTimeout)
+	newConnIdleTimeout = 50 * time.Millisecond
+
+	accepted := make(chan struct{})
+	handlerErr := make(chan error, 1)
+	srv := &Server{Handler: func(c *ServerConn) {
+		close(accepted)
+		_, err := c.Read(make([]byte, 1))
+		handlerErr <- err
+	}}
+	addr := startTestServer(t, srv)
+
+	// A client that connects and never sends anything.
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	<-accepted
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown = %v, want the new connection closed", err)
+	}
+	if err := <-handlerErr; !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("Read = %v, want net.ErrClosed", err)
+	}
+}
+
+func TestShutdownClosesIdleConns(t *testing.T) {
+	states := make(chan ConnState, 10)
+	accepted := make(chan struct{})
+	srv := &Server{
+		Handler: func(c *ServerConn) {
+			io.ReadFull(c, make([]byte, 5))
+			c.Write([]byte("world"))
+			c.SetIdle()
+			close(accepted)
+			c.Read(make([]byte, 1))
+		},
+		ConnState: func(c *ServerConn, state ConnState) { states <- state },
+	}
+	addr := startTestServer(t, srv)
+
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.Write([]byte("hello"))
+	io.ReadFull(c, make([]byte, 5))
+	<-accepted
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown = %v", err)
+	}
+
+	want := []ConnState{StateNew, StateActive, StateIdle, StateClosed}
+	for _, w := range want {
+		select {
+		case got := <-states:
+			if got != w {
+				t.Fatalf("state %v, want %v", got, w)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no state change to %v", w)
+		}
+	}
+}
+
+// TestShutdownContextDone checks that Shutdown returns once ctx is done,
+// even with a handler that does not return after its connection is
+// closed.
+func TestShutdownContextDone(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	accepted := make(chan struct{})
+	srv := &Server{Handler: func(c *ServerConn) {
+		c.Write([]byte("hello"))
+		close(accepted)
+		<-release
+	}}
+	addr := startTestServer(t, srv)
+
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	<-accepted
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := srv.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown = %v, want context.DeadlineExceeded", err)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Fatalf("Shutdown took %v to return", d)
+	}
+	if _, err := io.ReadFull(c, make([]byte, 5)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("Read = %v, want the connection closed", err)
+	}
+}
+
+// interruptConn is a net.Conn whose Read blocks until its read deadline
+// is set in the past, as Shutdown does to an idle connection, and then
+// returns what the test chose: data that came in at that moment, or a
+// timeout.
+type interruptConn struct {
+	net.Conn // nil; only the methods below are used
+
+	data         string
+	interrupted  chan struct{}
+	mu           sync.Mutex
+	readDeadline time.Time
+	closed       bool
+}
+
+func newInterruptConn(data string) *interruptConn {
+	return &interruptConn{data: data, interrupted: make(chan struct{})}
+}
+
+func (c *interruptConn) Read(b []byte) (int, error) {
+	<-c.interrupted
+	if c.data == "" {
+		return 0, os.ErrDeadlineExceeded
+	}
+	return copy(b, c.data), nil
+}
+
+func (c *interruptConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return 0, net.ErrClosed
+	}
+	return len(b), nil
+}
+
+func (c *interruptConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if t.Equal(aLongTimeAgo) {
+		close(c.interrupted)
+	}
+	c.readDeadline = t
+	return nil
+}
+
+func (c *interruptConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+func (c *interruptConn) LocalAddr() net.Addr  { return &net.TCPAddr{} }
+func (c *interruptConn) RemoteAddr() net.Addr { return &net.TCPAddr{} }
+
+// readWhileIdle starts a Read on an idle ServerConn over fc and has
+// Shutdown take the connection for idle while the Read is blocked.
+func readWhileIdle(t *testing.T, fc *interruptConn) (*ServerConn, <-chan error) {
+	t.Helper()
+	c := &ServerConn{Conn: fc, srv: &Server{}, state: StateIdle, since: time.Now()}
+	deadline := time.Now().Add(time.Hour)
+	c.SetReadDeadline(deadline)
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := c.Read(make([]byte, 5))
+		errc <- err
+	}()
+	for {
+		c.mu.Lock()
+		reading := c.reading
+		c.mu.Unlock()
+		if reading > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if c.closeIfIdle(time.Now()) {
+		t.Fatal("closeIfIdle closed the connection under a Read")
+	}
+	return c, errc
+}
+
+// TestServerConnDataOnShutdown checks that data that comes in as
+// Shutdown closes an idle connection is served: the Read returns it,
+// and the connection stays open and becomes active.
+func TestServerConnDataOnShutdown(t *testing.T) {
+	fc := newInterruptConn("hello")
+	c, errc := readWhileIdle(t, fc)
+	if err := <-errc; err != nil {
+		t.Fatalf("Read = %v, want the data", err)
+	}
+	if s := c.State(); s != StateActive {
+		t.Fatalf("state %v, want active", s)
+	}
+	if _, err := c.Write([]byte("world")); err != nil {
+		t.Fatalf("Write = %v", err)
+	}
+	if c.closeIfIdle(time.Now()) {
+		t.Fatal("closeIfIdle closed an active connection")
+	}
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if fc.closed {
+		t.Fatal("connection closed")
+	}
+	if !fc.readDeadline.Equal(c.readDeadline) {
+		t.Fatalf("read deadline %v, want %v set back", fc.readDeadline, c.readDeadline)
+	}
+}
+
+// TestServerConnIdleOnShutdown checks that the Read interrupted by
+// Shutdown closes an idle connection when no data came in.
+func TestServerConnIdleOnShutdown(t *testing.T) {
+	fc := newInterruptConn("")
+	c, errc := readWhileIdle(t, fc)
+	if err := <-errc; !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("Read = %v, want net.ErrClosed", err)
+	}
+	if !c.closeIfIdle(time.Now()) {
+		t.Fatal("closeIfIdle does not report the connection closed")
+	}
+	if _, err := c.Write([]byte("world")); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("Write = %v, want net.ErrClosed", err)
+	}
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if !fc.closed {
+		t.Fatal("connection not closed")
+	}
+}
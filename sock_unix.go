@@ -0,0 +1,380 @@
+//go:build darwin || linux
+
+package gotfo
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sync/atomic"
+	"syscall"
+)
+
+// clientFastOpen is whether dials can send data in the SYN.
+const clientFastOpen = true
+
+var fdCallback atomic.Pointer[func(int)]
+
+// SetFdCallback sets a function that is called with the descriptor of
+// every socket dialed, after binding and before the SYN is sent.
+//
+// Deprecated: use Dialer.Control or Dialer.ControlContext, which are set
+// per Dialer, can fail the dial and work on every platform, and
+// ListenConfig.Control for listeners.
+func SetFdCallback(fn func(int)) {
+	if fn == nil {
+		fdCallback.Store(nil)
+		return
+	}
+	fdCallback.Store(&fn)
+}
+
+// newSocket returns a socket from socket wrapped in an os.File. Since
+// the socket is non-blocking, the os package registers it with the
+// runtime poller, and its syscall.RawConn and deadlines can be used to
+// wait for the connect to complete.
+func newSocket(family int, ipv6only bool, fastOpen bool) (*os.File, syscall.RawConn, error) {
+	fd, err := socket(family, ipv6only, fastOpen)
+	if err != nil {
+		return nil, nil, err
+	}
+	f := os.NewFile(uintptr(fd), "tcp")
+	rc, err := f.SyscallConn()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, rc, nil
+}
+
+// fastOpenErrnoKind returns ErrFastOpenUnsupported or
+// ErrFastOpenDisabledByKernel if errno is how the kernel refuses Fast
+// Open, or nil. Setting TCP_FASTOPEN or TCP_FASTOPEN_CONNECT fails
+// without support for it, and a sendmsg with MSG_FASTOPEN fails when the
+// client side is disabled, or without a connection when the flag is
+// unknown.
+func fastOpenErrnoKind(errno syscall.Errno) error {
+	switch errno {
+	case syscall.EOPNOTSUPP:
+		return ErrFastOpenDisabledByKernel
+	case syscall.ENOPROTOOPT, syscall.EPROTONOSUPPORT, syscall.ENOTCONN, syscall.EPIPE:
+		return ErrFastOpenUnsupported
+	}
+	return nil
+}
+
+// controlErr runs fn on the socket behind rc and returns the error from
+// either of them.
+func controlErr(rc syscall.RawConn, fn func(fd int) error) error {
+	var err error
+	if cerr := rc.Control(func(fd uintptr) { err = fn(int(fd)) }); cerr != nil {
+		return cerr
+	}
+	return err
+}
+
+func (lc *ListenConfig) listenTCP(ctx context.Context, network string, laddr *net.TCPAddr) (net.Listener, error) {
+	family, ipv6only := favoriteAddrFamily(network, laddr, "listen")
+	sa, err := tcpAddrToSockaddr(family, laddr)
+	if err != nil {
+		return nil, err
+	}
+
+	f, rc, err := newSocket(family, ipv6only, false)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if lc.Control != nil {
+		if err := lc.Control(ctrlNetwork(network, family), laddr.String(), rc); err != nil {
+			return nil, err
+		}
+	}
+
+	backlog := lc.backlog()
+	if err := lc.enableFastOpen(rc, backlog); err != nil {
+		return nil, err
+	}
+
+	err = controlErr(rc, func(fd int) error {
+		if lc.ReusePort {
+			if err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, soReusePort, 1); err != nil {
+				return os.NewSyscallError("setsockopt", err)
+			}
+		}
+		if err := syscall.Bind(fd, sa); err != nil {
+			return os.NewSyscallError("bind", err)
+		}
+		if err := syscall.Listen(fd, backlog); err != nil {
+			return os.NewSyscallError("listen", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, err
+	}
+	return &TFOListener{TCPListener: ln.(*net.TCPListener), opts: lc.connOptions()}, nil
+}
+
+// enableFastOpen sets the Fast Open queue length and keys that lc asks
+// for on the listening socket behind rc. The queue length defaults to
+// backlog.
+func (lc *ListenConfig) enableFastOpen(rc syscall.RawConn, backlog int) error {
+	if len(lc.FastOpenKeys) > 0 {
+		b, err := fastOpenKeyBytes(lc.FastOpenKeys)
+		if err != nil {
+			return err
+		}
+		if err := setFastOpenKeys(rc, b); err != nil {
+			return err
+		}
+	}
+
+	if !lc.FastOpen {
+		return nil
+	}
+	qlen := lc.FastOpenQueueLen
+	if qlen <= 0 {
+		qlen = backlog
+	}
+	if err := controlErr(rc, func(fd int) error { return setFastOpenQueue(fd, qlen) }); err != nil {
+		return fastOpenSyscallError("setsockopt", err)
+	}
+	return nil
+}
+
+// dialSocket is a socket ready to dial an address: Control has run and
+// the local address is bound, but it is not connected yet.
+type dialSocket struct {
+	d  *Dialer
+	f  *os.File
+	rc syscall.RawConn
+	sa syscall.Sockaddr
+
+	// fastOpenConnect is whether TCP_FASTOPEN_CONNECT is set.
+	fastOpenConnect bool
+
+	// synBytes is how much data the connect sent in the SYN, even if
+	// the handshake then failed.
+	synBytes int
+}
+
+func (d *Dialer) newDialSocket(ctx context.Context, network string, laddr, raddr *net.TCPAddr) (*dialSocket, error) {
+	family, ipv6only := favoriteAddrFamily(network, raddr, "dial")
+	sa, err := tcpAddrToSockaddr(family, raddr)
+	if err != nil {
+		return nil, err
+	}
+
+	f, rc, err := newSocket(family, ipv6only, d.FastOpen)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := d.control(ctx, ctrlNetwork(network, family), raddr.String(), rc); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	// Where the BlackholeCache has turned Fast Open off, the option
+	// is left unset, and the dial connects at once.
+	fastOpenConnect := d.FastOpenConnect && !d.blackholeCache().disabled(raddr)
+	if fastOpenConnect {
+		if err := controlErr(rc, setFastOpenConnect); err != nil {
+			f.Close()
+			return nil, fastOpenSyscallError("setsockopt", err)
+		}
+	}
+
+	if laddr != nil {
+		lsa, err := tcpAddrToSockaddr(family, laddr)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if err := controlErr(rc, func(fd int) error {
+			if laddr.Port == 0 {
+				// Leave the port to the connect, so that the
+				// same one can go to several destinations.
+				// Kernels without the option pick it now.
+				setBindAddressNoPort(fd)
+			}
+			return os.NewSyscallError("bind", syscall.Bind(fd, lsa))
+		}); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+
+	if fn := fdCallback.Load(); fn != nil {
+		rc.Control(func(fd uintptr) { (*fn)(int(fd)) })
+	}
+	return &dialSocket{d: d, f: f, rc: rc, sa: sa, fastOpenConnect: fastOpenConnect}, nil
+}
+
+// connect connects the socket, sending data with it, in the SYN if
+// fastOpen is set, and returns it as a *net.TCPConn. The socket is
+// closed on return either way.
+func (s *dialSocket) connect(ctx context.Context, data []byte, fastOpen bool) (*net.TCPConn, error) {
+	defer s.f.Close()
+
+	// With TCP_FASTOPEN_CONNECT, a plain connect returns at once and
+	// leaves the SYN to the first write.
+	n, err := connect(ctx, s.f, s.rc, s.sa, data, fastOpen && !s.fastOpenConnect)
+	s.synBytes = n
+	if err != nil {
+		return nil, err
+	}
+
+	fc, err := net.FileConn(s.f)
+	if err != nil {
+		return nil, err
+	}
+	c := fc.(*net.TCPConn)
+	recordSynBytes(c, n)
+
+	if n < len(data) {
+		// The SYN did not carry all of the data, because there
+		// was no Fast Open cookie or Fast Open is off.
+		if deadline, ok := ctx.Deadline(); ok {
+			c.SetWriteDeadline(deadline)
+			defer c.SetWriteDeadline(noDeadline)
+		}
+		if _, err := c.Write(data[n:]); err != nil {
+			c.Close()
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				return nil, errTimeout
+			}
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// close closes a socket that will not be connected.
+func (s *dialSocket) close() error {
+	return s.f.Close()
+}
+
+// connect connects the socket behind f to ra, sending data in the SYN
+// if fastOpen is set, and waits on the runtime poller for the handshake
+// to complete. It returns how many bytes of data were sent, also when
+// the handshake fails after the SYN went out.
+//
+// Waiting costs nothing with Fast Open: the server acts on the data as
+// soon as the SYN arrives, and the kernel would hold back any further
+// writes until the handshake completes anyway.
+func connect(ctx context.Context, f *os.File, rc syscall.RawConn, ra syscall.Sockaddr, data []byte, fastOpen bool) (n int, ret error) {
+	var err error
+	if cerr := rc.Control(func(fd uintptr) {
+		if fastOpen {
+			n, err = syscall.SendmsgN(int(fd), data, nil, ra, msgFastOpen)
+		} else {
+			err = syscall.Connect(int(fd), ra)
+		}
+	}); cerr != nil {
+		return 0, cerr
+	}
+	switch err {
+	case syscall.EINPROGRESS, syscall.EALREADY, syscall.EINTR:
+	case nil, syscall.EISCONN:
+		if !fastOpen {
+			select {
+			case <-ctx.Done():
+				return 0, mapErr(ctx.Err())
+			default:
+			}
+			return 0, nil
+		}
+	default:
+		if fastOpen {
+			return 0, fastOpenSyscallError("sendmsg", err)
+		}
+		return 0, os.NewSyscallError("connect", err)
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && !deadline.IsZero() {
+		f.SetWriteDeadline(deadline)
+		defer f.SetWriteDeadline(noDeadline)
+	}
+
+	// Wait for the goroutine converting context.Done into a write timeout
+	// to exist, otherwise our caller might cancel the context and
+	// cause f.SetWriteDeadline(aLongTimeAgo) to cancel a successful dial.
+	done := make(chan struct{})
+	interruptRes := make(chan error)
+	defer func() {
+		close(done)
+		if ctxErr := <-interruptRes; ctxErr != nil && ret == nil {
+			// The interrupter goroutine called SetWriteDeadline,
+			// but the connect code below had returned from
+			// waiting already and did a successful connect.
+			// Report the cancellation instead.
+			ret = mapErr(ctxErr)
+		}
+	}()
+	go func() {
+		select {
+		case <-ctx.Done():
+			// Force the runtime's poller to immediately give up
+			// waiting for writability, unblocking the wait below.
+			f.SetWriteDeadline(aLongTimeAgo)
+			interruptRes <- ctx.Err()
+		case <-done:
+			interruptRes <- nil
+		}
+	}()
+
+	// Performing multiple connect system calls on a non-blocking
+	// socket under Unix variants does not necessarily result in
+	// earlier errors being returned. Instead, once the runtime
+	// poller tells us that the socket is ready, get the SO_ERROR
+	// socket option to see if the connection succeeded or failed.
+	var connErr error
+	err = rc.Write(func(fd uintptr) bool {
+		nerr, err := syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_ERROR)
+		if err != nil {
+			connErr = os.NewSyscallError("getsockopt", err)
+			return true
+		}
+		switch err := syscall.Errno(nerr); err {
+		case syscall.EINPROGRESS, syscall.EALREADY, syscall.EINTR:
+			return false
+		case syscall.EISCONN:
+			return true
+		case syscall.Errno(0):
+			// The poller also wakes us up right away and
+			// spuriously; check that we are really connected
+			// and wait again if not.
+			_, err := syscall.Getpeername(int(fd))
+			return err == nil
+		default:
+			connErr = os.NewSyscallError("connect", err)
+			return true
+		}
+	})
+	if err != nil {
+		select {
+		case <-ctx.Done():
+			return n, mapErr(ctx.Err())
+		default:
+		}
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			// The write deadline, which is that of ctx, passed
+			// before ctx noticed.
+			return n, errTimeout
+		}
+		return n, err
+	}
+	if connErr != nil {
+		return n, connErr
+	}
+	return n, nil
+}
@@ -0,0 +1,99 @@
+package gotfo
+
+import (
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const tcpUserTimeout = 0x12
+
+func checkUserTimeout() error {
+	return nil
+}
+
+// setUserTimeout sets TCP_USER_TIMEOUT, which the kernel takes in
+// milliseconds.
+func setUserTimeout(rc syscall.RawConn, d time.Duration) error {
+	ms := int(d / time.Millisecond)
+	if ms < 0 {
+		ms = 0
+	}
+	var err error
+	if cerr := rc.Control(func(fd uintptr) {
+		err = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, tcpUserTimeout, ms)
+	}); cerr != nil {
+		return cerr
+	}
+	if err != nil {
+		return os.NewSyscallError("setsockopt", err)
+	}
+	return nil
+}
+
+// setFastOpenKeys sets TCP_FASTOPEN_KEY to b, which holds one or two
+// keys. Linux takes keys per socket from 4.20, and a backup key from
+// 5.3.
+func setFastOpenKeys(rc syscall.RawConn, b []byte) error {
+	err := controlErr(rc, func(fd int) error {
+		return syscall.SetsockoptString(fd, syscall.SOL_TCP, TCP_FASTOPEN_KEY, string(b))
+	})
+	if err != nil {
+		return fastOpenSyscallError("setsockopt", err)
+	}
+	return nil
+}
+
+// getFastOpenKeys returns TCP_FASTOPEN_KEY, the primary key followed by
+// the backup key if there is one.
+func getFastOpenKeys(rc syscall.RawConn) ([]byte, error) {
+	b := make([]byte, 2*len(FastOpenKey{}))
+	err := controlErr(rc, func(fd int) error {
+		l := uint32(len(b))
+		_, _, e := syscall.Syscall6(sysGetsockopt, uintptr(fd), syscall.SOL_TCP, TCP_FASTOPEN_KEY,
+			uintptr(unsafe.Pointer(&b[0])), uintptr(unsafe.Pointer(&l)), 0)
+		if e != 0 {
+			return e
+		}
+		b = b[:l]
+		return nil
+	})
+	if err != nil {
+		return nil, fastOpenSyscallError("getsockopt", err)
+	}
+	return b, nil
+}
+
+const (
+	soAttachReusePortCBPF = 0x33
+
+	bpfMod = 0x90
+	// skfAdCPU is SKF_AD_OFF + SKF_AD_CPU, the offset that loads the
+	// number of the current CPU.
+	skfAdCPU = 0xfffff000 + 36
+)
+
+// attachReusePortCPU attaches a classic BPF program to the SO_REUSEPORT
+// group of the socket behind rc, returning the index of the socket to
+// hand each connection to: the current CPU modulo n.
+func attachReusePortCPU(rc syscall.RawConn, n int) error {
+	prog := []syscall.SockFilter{
+		{Code: syscall.BPF_LD | syscall.BPF_W | syscall.BPF_ABS, K: skfAdCPU},
+		{Code: syscall.BPF_ALU | bpfMod | syscall.BPF_K, K: uint32(n)},
+		{Code: syscall.BPF_RET | syscall.BPF_A},
+	}
+	fprog := syscall.SockFprog{Len: uint16(len(prog)), Filter: &prog[0]}
+	err := controlErr(rc, func(fd int) error {
+		_, _, e := syscall.Syscall6(sysSetsockopt, uintptr(fd), syscall.SOL_SOCKET, soAttachReusePortCBPF,
+			uintptr(unsafe.Pointer(&fprog)), unsafe.Sizeof(fprog), 0)
+		if e != 0 {
+			return e
+		}
+		return nil
+	})
+	if err != nil {
+		return os.NewSyscallError("setsockopt", err)
+	}
+	return nil
+}
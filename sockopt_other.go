@@ -0,0 +1,33 @@
+//go:build !linux
+
+package gotfo
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// checkUserTimeout fails, as there is no TCP_USER_TIMEOUT outside Linux.
+func checkUserTimeout() error {
+	return os.NewSyscallError("setsockopt", syscall.ENOPROTOOPT)
+}
+
+func setUserTimeout(rc syscall.RawConn, d time.Duration) error {
+	return checkUserTimeout()
+}
+
+// setFastOpenKeys fails, as there is no TCP_FASTOPEN_KEY outside Linux.
+func setFastOpenKeys(rc syscall.RawConn, b []byte) error {
+	return fastOpenSyscallError("setsockopt", syscall.ENOPROTOOPT)
+}
+
+func getFastOpenKeys(rc syscall.RawConn) ([]byte, error) {
+	return nil, fastOpenSyscallError("getsockopt", syscall.ENOPROTOOPT)
+}
+
+// attachReusePortCPU fails, as there is no SO_ATTACH_REUSEPORT_CBPF
+// outside Linux.
+func attachReusePortCPU(rc syscall.RawConn, n int) error {
+	return os.NewSyscallError("setsockopt", syscall.ENOPROTOOPT)
+}
@@ -0,0 +1,10 @@
+//go:build linux && !386
+
+package gotfo
+
+import "syscall"
+
+const (
+	sysGetsockopt = syscall.SYS_GETSOCKOPT
+	sysSetsockopt = syscall.SYS_SETSOCKOPT
+)
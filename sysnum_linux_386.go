@@ -0,0 +1,8 @@
+package gotfo
+
+// The syscall package multiplexes socket calls through socketcall on
+// 386, but Linux 4.3 and later also take them directly.
+const (
+	sysGetsockopt = 365
+	sysSetsockopt = 366
+)
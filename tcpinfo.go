@@ -0,0 +1,150 @@
+package gotfo
+
+import (
+	"net"
+	"runtime"
+	"sync"
+	"weak"
+)
+
+// FastOpenInfo reports what happened to Fast Open on a connection, and
+// the options negotiated with the peer.
+type FastOpenInfo struct {
+	// SynData is the TCPI_OPT_SYN_DATA flag of TCP_INFO. On a
+	// dialed connection, the kernel sets it once the peer has
+	// acknowledged the data sent in the SYN. On an accepted one, it
+	// is set when the SYN carried data that was accepted.
+	SynData bool
+
+	// SynDataAcked reports whether the SYN carried data and it was
+	// acknowledged, that is whether Fast Open saved a round trip.
+	// Unlike SynBytes, it is also known for connections dialed with
+	// Dialer.FastOpenConnect.
+	SynDataAcked bool
+
+	// SynBytes is the number of bytes of data that went in the SYN.
+	// On a dialed connection it is zero when there was no cookie
+	// for the peer yet, Fast Open was off, or the connection was
+	// dialed with Dialer.FastOpenConnect, which hands the data to
+	// the kernel in an ordinary Write. On an accepted one it
+	// is only known for connections from TFOListener.AcceptTFO, and
+	// also counts any data that arrived before the accept. It is
+	// zero for connections from elsewhere.
+	SynBytes int
+
+	// ClientFail is the kernel's reason for Fast Open failing on a
+	// dialed connection. Kernels before Linux 5.5 always report
+	// FastOpenClientFailUnspec.
+	ClientFail FastOpenClientFail
+
+	// SACK, Timestamps, WindowScale and ECN report whether the
+	// selective acknowledgement, timestamp, window scale and ECN
+	// options were negotiated with the peer.
+	SACK        bool
+	Timestamps  bool
+	WindowScale bool
+	ECN         bool
+
+	// SndWScale and RcvWScale are the window scale shifts in each
+	// direction when WindowScale is set.
+	SndWScale uint8
+	RcvWScale uint8
+}
+
+// FastOpenClientFail is the tcpi_fastopen_client_fail field of TCP_INFO.
+type FastOpenClientFail uint8
+
+const (
+	// FastOpenClientFailUnspec means Fast Open did not fail, or the
+	// kernel did not say why.
+	FastOpenClientFailUnspec FastOpenClientFail = iota
+	// FastOpenCookieUnavailable means there was no cookie for the
+	// peer, so the SYN only asked for one.
+	FastOpenCookieUnavailable
+	// FastOpenDataNotAcked means the peer acknowledged the SYN but
+	// not the data in it.
+	FastOpenDataNotAcked
+	// FastOpenSynRetransmitted means the SYN carrying data was
+	// retransmitted, as when a middlebox drops it.
+	FastOpenSynRetransmitted
+)
+
+func (f FastOpenClientFail) String() string {
+	switch f {
+	case FastOpenClientFailUnspec:
+		return "unspecified"
+	case FastOpenCookieUnavailable:
+		return "cookie unavailable"
+	case FastOpenDataNotAcked:
+		return "data not acked"
+	case FastOpenSynRetransmitted:
+		return "SYN retransmitted"
+	}
+	return "unknown"
+}
+
+// connRecord is what gotfo knows about a connection that the kernel
+// does not report: how much of the dial data went in its SYN, and the
+// way it was dialed.
+type connRecord struct {
+	synBytes int
+	path     DialPath
+}
+
+// connRecords holds the connRecord of each connection that has one.
+// Entries go away with their connection.
+var connRecords struct {
+	sync.Mutex
+	m map[weak.Pointer[net.TCPConn]]connRecord
+}
+
+func recordSynBytes(c *net.TCPConn, n int) {
+	if n <= 0 {
+		return
+	}
+	updateRecord(c, func(r *connRecord) { r.synBytes = n })
+}
+
+func recordDialPath(c *net.TCPConn, path DialPath) {
+	if path == DialPathRegular {
+		return
+	}
+	updateRecord(c, func(r *connRecord) { r.path = path })
+}
+
+func updateRecord(c *net.TCPConn, fn func(*connRecord)) {
+	p := weak.Make(c)
+	connRecords.Lock()
+	if connRecords.m == nil {
+		connRecords.m = make(map[weak.Pointer[net.TCPConn]]connRecord)
+	}
+	r, ok := connRecords.m[p]
+	fn(&r)
+	connRecords.m[p] = r
+	connRecords.Unlock()
+	if !ok {
+		runtime.AddCleanup(c, func(p weak.Pointer[net.TCPConn]) {
+			connRecords.Lock()
+			delete(connRecords.m, p)
+			connRecords.Unlock()
+		}, p)
+	}
+}
+
+func lookupRecord(c net.Conn) connRecord {
+	var tc *net.TCPConn
+	switch c := c.(type) {
+	case *net.TCPConn:
+		tc = c
+	case *fastOpenConn:
+		tc = c.TCPConn
+	case *deferredConn:
+		tc = c.connected()
+	}
+	if tc == nil {
+		return connRecord{}
+	}
+	connRecords.Lock()
+	defer connRecords.Unlock()
+	return connRecords.m[weak.Make(tc)]
+}
@@ -0,0 +1,150 @@
+package gotfo
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	tcpiOptTimestamps = 0x1
+	tcpiOptSack       = 0x2
+	tcpiOptWscale     = 0x4
+	tcpiOptEcn        = 0x8
+	tcpiOptSynData    = 0x20
+)
+
+// tcpiBytesReceived is the offset of tcpi_bytes_received in struct
+// tcp_info, present since Linux 4.1.
+const tcpiBytesReceived = 128
+
+// tcpInfo holds the leading bytes of struct tcp_info, which is all
+// this package reads. The kernel copies as much of the struct as it
+// has, and n is how much that was.
+type tcpInfo struct {
+	b [tcpiBytesReceived + 8]byte
+	n int
+}
+
+func (ti *tcpInfo) options() uint8 { return ti.b[5] }
+
+// Bitfields are allocated from the low bit on little-endian machines and
+// from the high bit on big-endian ones.
+var bigEndian = binary.NativeEndian.Uint16([]byte{0, 1}) == 1
+
+// wscale decodes the four-bit tcpi_snd_wscale and tcpi_rcv_wscale
+// fields sharing the seventh byte.
+func (ti *tcpInfo) wscale() (snd, rcv uint8) {
+	if bigEndian {
+		return ti.b[6] >> 4, ti.b[6] & 0xf
+	}
+	return ti.b[6] & 0xf, ti.b[6] >> 4
+}
+
+// fastOpenClientFail decodes the two-bit tcpi_fastopen_client_fail
+// field, which follows the one-bit tcpi_delivery_rate_app_limited in
+// the eighth byte.
+func (ti *tcpInfo) fastOpenClientFail() FastOpenClientFail {
+	if bigEndian {
+		return FastOpenClientFail(ti.b[7] >> 5 & 0x3)
+	}
+	return FastOpenClientFail(ti.b[7] >> 1 & 0x3)
+}
+
+// bytesReceived returns tcpi_bytes_received, or -1 if the kernel is
+// too old to report it.
+func (ti *tcpInfo) bytesReceived() int64 {
+	if ti.n < tcpiBytesReceived+8 {
+		return -1
+	}
+	return int64(binary.NativeEndian.Uint64(ti.b[tcpiBytesReceived:]))
+}
+
+func getTCPInfo(c net.Conn) (*tcpInfo, error) {
+	sc, ok := c.(syscall.Conn)
+	if !ok {
+		return nil, errors.New("gotfo: connection has no file descriptor")
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var ti tcpInfo
+	err = controlErr(rc, func(fd int) error {
+		l := uint32(len(ti.b))
+		_, _, e := syscall.Syscall6(sysGetsockopt, uintptr(fd), syscall.IPPROTO_TCP, syscall.TCP_INFO,
+			uintptr(unsafe.Pointer(&ti.b[0])), uintptr(unsafe.Pointer(&l)), 0)
+		if e != 0 {
+			return os.NewSyscallError("getsockopt", e)
+		}
+		ti.n = int(l)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ti, nil
+}
+
+// FastOpenStatus reports whether Fast Open carried data in the SYN of c,
+// and which options were negotiated with the peer, from the TCP_INFO of
+// its socket. c may be dialed or accepted.
+func FastOpenStatus(c net.Conn) (*FastOpenInfo, error) {
+	ti, err := getTCPInfo(c)
+	if err != nil {
+		return nil, err
+	}
+	opts := ti.options()
+	info := &FastOpenInfo{
+		SynData:     opts&tcpiOptSynData != 0,
+		SynBytes:    lookupRecord(c).synBytes,
+		ClientFail:  ti.fastOpenClientFail(),
+		SACK:        opts&tcpiOptSack != 0,
+		Timestamps:  opts&tcpiOptTimestamps != 0,
+		WindowScale: opts&tcpiOptWscale != 0,
+		ECN:         opts&tcpiOptEcn != 0,
+	}
+	if info.WindowScale {
+		info.SndWScale, info.RcvWScale = ti.wscale()
+	}
+	// Linux only flags SYN data once the peer has taken it.
+	info.SynDataAcked = info.SynData && info.ClientFail != FastOpenDataNotAcked
+	return info, nil
+}
+
+// synDataLost reports whether a dialed connection that sent data in the
+// SYN has the data unacknowledged or had to retransmit the SYN without
+// it. It reports false if TCP_INFO cannot be read.
+func synDataLost(c *net.TCPConn) bool {
+	ti, err := getTCPInfo(c)
+	if err != nil {
+		return false
+	}
+	return ti.synDataLost()
+}
+
+func (ti *tcpInfo) synDataLost() bool {
+	return ti.options()&tcpiOptSynData == 0 || ti.fastOpenClientFail() == FastOpenSynRetransmitted
+}
+
+// acceptSynBytes returns how much data came with the SYN of a connection
+// accepted with Fast Open. The kernel starts tcpi_bytes_received at the
+// length of the SYN data, so this is exact unless more data arrived
+// before the connection was accepted.
+func acceptSynBytes(c *net.TCPConn) (int, error) {
+	ti, err := getTCPInfo(c)
+	if err != nil {
+		return 0, err
+	}
+	if ti.options()&tcpiOptSynData == 0 {
+		return 0, nil
+	}
+	n := ti.bytesReceived()
+	if n < 0 {
+		return 0, nil
+	}
+	return int(n), nil
+}
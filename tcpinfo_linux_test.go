@@ -0,0 +1,48 @@
+package gotfo
+
+import (
+	"net"
+	"testing"
+)
+
+func TestTCPInfoSynDataLost(t *testing.T) {
+	tests := []struct {
+		synData bool
+		fail    FastOpenClientFail
+		lost    bool
+	}{
+		{true, FastOpenClientFailUnspec, false},
+		// Kernels before 5.5 report no failure.
+		{false, FastOpenClientFailUnspec, true},
+		{false, FastOpenDataNotAcked, true},
+		{false, FastOpenSynRetransmitted, true},
+	}
+	for _, tt := range tests {
+		var ti tcpInfo
+		if tt.synData {
+			ti.b[5] = tcpiOptSynData
+		}
+		if bigEndian {
+			ti.b[7] = uint8(tt.fail) << 5
+		} else {
+			ti.b[7] = uint8(tt.fail) << 1
+		}
+		if got := ti.synDataLost(); got != tt.lost {
+			t.Errorf("SYN data %v, %v: lost = %v, want %v", tt.synData, tt.fail, got, tt.lost)
+		}
+	}
+}
+
+// TestSynDataLostPlainConnect checks that a connection whose SYN
+// carried no data reads as having lost it.
+func TestSynDataLostPlainConnect(t *testing.T) {
+	ln := newTestListener(t)
+	c, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if !synDataLost(c.(*net.TCPConn)) {
+		t.Fatal("a plain connect does not read as SYN data lost")
+	}
+}
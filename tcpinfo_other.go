@@ -0,0 +1,24 @@
+//go:build !linux
+
+package gotfo
+
+import (
+	"errors"
+	"net"
+	"runtime"
+)
+
+// FastOpenStatus reports whether Fast Open carried the dial data of c in
+// the SYN. It needs TCP_INFO and is only supported on Linux.
+func FastOpenStatus(c net.Conn) (*FastOpenInfo, error) {
+	return nil, errors.New("gotfo: FastOpenStatus is not supported on " + runtime.GOOS)
+}
+
+func acceptSynBytes(c *net.TCPConn) (int, error) {
+	return 0, errors.New("gotfo: AcceptTFO is not supported on " + runtime.GOOS)
+}
+
+// synDataLost cannot tell without TCP_INFO, and reports false.
+func synDataLost(c *net.TCPConn) bool {
+	return false
+}
@@ -4,78 +4,279 @@ import (
 	"context"
 	"errors"
 	"net"
+	"os"
+	"strconv"
+	"sync"
 	"syscall"
 	"time"
-	"unsafe"
 )
 
 var (
-	errTimeout   = errors.New("operation timed out")
-	errCanceled  = errors.New("operation was canceled")
-	errClosing   = errors.New("use of closed network connection")
 	aLongTimeAgo = time.Unix(1, 0)
 	noDeadline   = time.Time{}
 )
 
-type conn struct {
-	fd *netFD
+// TFOListener is the net.Listener returned by Listen and
+// ListenConfig.Listen.
+type TFOListener struct {
+	*net.TCPListener
+	opts connOptions
+
+	// mu guards deadline, the one set with SetDeadline, and
+	// interrupts, the number of AcceptContext calls whose context is
+	// done. While there are any, the deadline on the socket is
+	// aLongTimeAgo, to wake up every accept blocked on the poller, and
+	// resumed is closed once they are over. generation counts the
+	// interrupts ever set, so that an accept can tell whether one came
+	// and went while it was blocked.
+	mu         sync.Mutex
+	deadline   time.Time
+	interrupts int
+	generation uint64
+	resumed    chan struct{}
 }
 
-type TCPConn struct {
-	conn
+// acceptInterrupt pairs up interrupt and resume for one AcceptContext
+// call, whichever of them runs first. It is guarded by the mu of the
+// listener.
+type acceptInterrupt struct {
+	set  bool // interrupt has taken effect
+	done bool // the accept has returned, so interrupt must not
 }
 
-type TCPListener struct {
-	fd *netFD
+// Accept waits for and returns the next connection to the listener,
+// with the options of its ListenConfig applied.
+func (l *TFOListener) Accept() (net.Conn, error) {
+	c, err := l.AcceptTCP()
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
 }
 
-// ipv4 only
-func sockaddrToTCPAddr(sa syscall.Sockaddr) net.Addr {
-	addr := sa.(*syscall.SockaddrInet4)
-	return &net.TCPAddr{IP: addr.Addr[0:], Port: addr.Port}
+// AcceptTCP is like Accept but returns a *net.TCPConn.
+func (l *TFOListener) AcceptTCP() (*net.TCPConn, error) {
+	return l.accept(context.Background())
 }
 
-// ipv4 only
-func tcpAddrToSockaddr(addr *net.TCPAddr) syscall.Sockaddr {
-	sa := &syscall.SockaddrInet4{Port: addr.Port}
-	copy(sa.Addr[:], addr.IP.To4())
-	return sa
+// AcceptContext is like Accept, but gives up when ctx is done. The
+// listener stays open, and connections still queue up for the next
+// accept; the error then wraps that of ctx.
+func (l *TFOListener) AcceptContext(ctx context.Context) (net.Conn, error) {
+	c, err := l.AcceptTCPContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
 }
 
-func mapErr(err error) error {
-	switch err {
-	case context.Canceled:
-		return errCanceled
-	case context.DeadlineExceeded:
-		return errTimeout
-	default:
-		return err
+// AcceptTCPContext is like AcceptContext but returns a *net.TCPConn.
+func (l *TFOListener) AcceptTCPContext(ctx context.Context) (*net.TCPConn, error) {
+	if ctx.Done() == nil {
+		return l.accept(ctx)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, l.acceptError(mapErr(err))
 	}
+	// Force the runtime's poller to give up waiting for a connection
+	// once ctx is done, unblocking the accept below.
+	in := new(acceptInterrupt)
+	stop := context.AfterFunc(ctx, func() { l.interrupt(in) })
+	c, err := l.accept(ctx)
+	stop()
+	l.resume(in)
+	return c, err
 }
 
-func newTCPConn(fd *netFD) *net.TCPConn {
-	dummyConn := &TCPConn{}
-	dummyConn.conn.fd = fd
+// SetDeadline sets the deadline of the listener, like that of
+// net.TCPListener. It can be used alongside AcceptContext.
+func (l *TFOListener) SetDeadline(t time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.deadline = t
+	if l.interrupts > 0 {
+		// resume sets it once the interrupts are over.
+		return nil
+	}
+	return l.TCPListener.SetDeadline(t)
+}
+
+func (l *TFOListener) interrupt(in *acceptInterrupt) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if in.done {
+		return
+	}
+	in.set = true
+	l.generation++
+	if l.interrupts == 0 {
+		l.resumed = make(chan struct{})
+	}
+	l.interrupts++
+	l.TCPListener.SetDeadline(aLongTimeAgo)
+}
 
-	if fd.incref() == nil {
-		syscall.SetsockoptInt(fd.sysfd, syscall.IPPROTO_TCP, syscall.TCP_NODELAY, 1)
-		fd.decref()
+func (l *TFOListener) resume(in *acceptInterrupt) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	in.done = true
+	if !in.set {
+		return
+	}
+	l.interrupts--
+	if l.interrupts == 0 {
+		l.TCPListener.SetDeadline(l.deadline)
+		close(l.resumed)
 	}
+}
 
-	conn := (*net.TCPConn)(unsafe.Pointer(dummyConn))
+// accept accepts the next connection and applies the options to it.
+// If ctx is done, it reports the error of ctx.
+func (l *TFOListener) accept(ctx context.Context) (*net.TCPConn, error) {
+	for {
+		l.mu.Lock()
+		generation, interrupting := l.generation, l.interrupts > 0
+		l.mu.Unlock()
 
-	return conn
+		c, err := l.TCPListener.AcceptTCP()
+		if err == nil {
+			if err := l.opts.apply(c); err != nil {
+				c.Close()
+				return nil, err
+			}
+			return c, nil
+		}
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			return nil, err
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, l.acceptError(mapErr(ctxErr))
+		}
+		resumed, retry := l.interrupted(generation, interrupting)
+		if !retry {
+			return nil, err
+		}
+		if resumed != nil {
+			select {
+			case <-resumed:
+			case <-ctx.Done():
+			}
+		}
+	}
 }
 
-func newTCPListener(fd *netFD, returnWrapper bool) net.Listener {
-	dummyListener := &TCPListener{}
-	dummyListener.fd = fd
+// interrupted tells, after an accept that started at generation timed
+// out, whether that may have been caused by the context of another
+// AcceptContext call, in effect then if interrupting is set, rather than
+// by a deadline, in which case the accept should be retried. While the
+// interrupt lasts, it returns a channel closed when it is over.
+func (l *TFOListener) interrupted(generation uint64, interrupting bool) (resumed <-chan struct{}, retry bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.interrupts > 0 {
+		return l.resumed, true
+	}
+	return nil, interrupting || l.generation != generation
+}
 
-	listener := (*net.TCPListener)(unsafe.Pointer(dummyListener))
+func (l *TFOListener) acceptError(err error) error {
+	return opError("accept", "tcp", nil, l.Addr().(*net.TCPAddr), err)
+}
 
-	if returnWrapper {
-		return &TFOListener{listener, fd}
+// AcceptTFO is like Accept but also reports whether the connection came
+// in over Fast Open, with how much data arrived in the SYN, and which
+// options the peer negotiated. Like FastOpenStatus, it is only
+// supported on Linux.
+func (l *TFOListener) AcceptTFO() (*net.TCPConn, *FastOpenInfo, error) {
+	c, err := l.AcceptTCP()
+	if err != nil {
+		return nil, nil, err
+	}
+	n, err := acceptSynBytes(c)
+	if err != nil {
+		c.Close()
+		return nil, nil, err
 	}
+	recordSynBytes(c, n)
+	info, err := FastOpenStatus(c)
+	if err != nil {
+		c.Close()
+		return nil, nil, err
+	}
+	return c, info, nil
+}
+
+// favoriteAddrFamily returns the address family and IPV6_V6ONLY setting
+// for a socket on network that will dial or listen on addr. A listener
+// on the unspecified address gets a dual-stack IPv6 socket unless the
+// network is "tcp6".
+func favoriteAddrFamily(network string, addr *net.TCPAddr, mode string) (family int, ipv6only bool) {
+	switch network[len(network)-1] {
+	case '4':
+		return syscall.AF_INET, false
+	case '6':
+		return syscall.AF_INET6, true
+	}
+
+	if mode == "listen" && (addr.IP == nil || addr.IP.Equal(net.IPv6zero)) {
+		return syscall.AF_INET6, false
+	}
+	if addr.IP == nil || addr.IP.To4() != nil {
+		return syscall.AF_INET, false
+	}
+	return syscall.AF_INET6, false
+}
+
+func tcpAddrToSockaddr(family int, addr *net.TCPAddr) (syscall.Sockaddr, error) {
+	switch family {
+	case syscall.AF_INET:
+		ip := addr.IP
+		if len(ip) == 0 {
+			ip = net.IPv4zero
+		}
+		ip4 := ip.To4()
+		if ip4 == nil {
+			return nil, &net.AddrError{Err: "non-IPv4 address", Addr: ip.String()}
+		}
+		sa := &syscall.SockaddrInet4{Port: addr.Port}
+		copy(sa.Addr[:], ip4)
+		return sa, nil
+	case syscall.AF_INET6:
+		// The IPv4 wildcard is widened to the IPv6 one, so that a
+		// dual-stack socket covers both families.
+		ip := addr.IP
+		if len(ip) == 0 || ip.Equal(net.IPv4zero) {
+			ip = net.IPv6zero
+		}
+		ip6 := ip.To16()
+		if ip6 == nil {
+			return nil, &net.AddrError{Err: "non-IPv6 address", Addr: ip.String()}
+		}
+		sa := &syscall.SockaddrInet6{Port: addr.Port, ZoneId: uint32(zoneToInt(addr.Zone))}
+		copy(sa.Addr[:], ip6)
+		return sa, nil
+	}
+	return nil, &net.AddrError{Err: "unexpected address family", Addr: addr.String()}
+}
+
+func zoneToInt(zone string) int {
+	if zone == "" {
+		return 0
+	}
+	if ifi, err := net.InterfaceByName(zone); err == nil {
+		return ifi.Index
+	}
+	n, _ := strconv.Atoi(zone)
+	return n
+}
 
-	return listener
+func mapErr(err error) error {
+	switch err {
+	case context.Canceled:
+		return errCanceled
+	case context.DeadlineExceeded:
+		return errTimeout
+	default:
+		return err
+	}
 }
@@ -0,0 +1,129 @@
+package gotfo
+
+import (
+	"net"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+func TestFavoriteAddrFamily(t *testing.T) {
+	tests := []struct {
+		network, mode string
+		ip            net.IP
+		family        int
+		ipv6only      bool
+	}{
+		{"tcp", "listen", nil, syscall.AF_INET6, false},
+		{"tcp", "listen", net.IPv6zero, syscall.AF_INET6, false},
+		{"tcp", "listen", net.IPv4zero, syscall.AF_INET, false},
+		{"tcp", "dial", net.IPv4(127, 0, 0, 1), syscall.AF_INET, false},
+		{"tcp", "dial", net.IPv6loopback, syscall.AF_INET6, false},
+		{"tcp4", "listen", nil, syscall.AF_INET, false},
+		{"tcp6", "listen", nil, syscall.AF_INET6, true},
+		{"tcp6", "dial", net.IPv6loopback, syscall.AF_INET6, true},
+	}
+	for _, tt := range tests {
+		family, ipv6only := favoriteAddrFamily(tt.network, &net.TCPAddr{IP: tt.ip}, tt.mode)
+		if family != tt.family || ipv6only != tt.ipv6only {
+			t.Errorf("favoriteAddrFamily(%s, %v, %s) = %d, %v, want %d, %v",
+				tt.network, tt.ip, tt.mode, family, ipv6only, tt.family, tt.ipv6only)
+		}
+	}
+}
+
+func TestTCPAddrToSockaddrZone(t *testing.T) {
+	zones := map[string]uint32{"7": 7}
+	if ifs, err := net.Interfaces(); err == nil && len(ifs) > 0 {
+		zones[ifs[0].Name] = uint32(ifs[0].Index)
+	}
+	for zone, id := range zones {
+		sa, err := tcpAddrToSockaddr(syscall.AF_INET6, &net.TCPAddr{IP: net.ParseIP("fe80::1"), Port: 80, Zone: zone})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sa6 := sa.(*syscall.SockaddrInet6); sa6.ZoneId != id || sa6.Port != 80 {
+			t.Errorf("zone %q: sockaddr %+v, want zone ID %d", zone, sa6, id)
+		}
+	}
+
+	if _, err := tcpAddrToSockaddr(syscall.AF_INET, &net.TCPAddr{IP: net.IPv6loopback}); err == nil {
+		t.Error("an IPv6 address was taken for an IPv4 socket")
+	}
+}
+
+// loopbackInterface returns the name of the loopback interface, or
+// skips the test if IPv6 is not available on it.
+func loopbackInterface(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 is not available: %v", err)
+	}
+	ln.Close()
+	ifs, err := net.Interfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ifi := range ifs {
+		if ifi.Flags&net.FlagLoopback != 0 {
+			return ifi.Name
+		}
+	}
+	t.Skip("no loopback interface")
+	return ""
+}
+
+// TestListenDualStack checks that a "tcp" listener on the unspecified
+// address accepts IPv4 and IPv6 peers, and reports their addresses in
+// their own family.
+func TestListenDualStack(t *testing.T) {
+	lo := loopbackInterface(t)
+	ln, err := Listen(":0", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	port := strconv.Itoa(ln.Addr().(*net.TCPAddr).Port)
+
+	for _, host := range []string{"127.0.0.1", "::1", "::1%" + lo} {
+		c, err := Dial(net.JoinHostPort(host, port), true, []byte("hello"))
+		if err != nil {
+			t.Fatalf("dial %s: %v", host, err)
+		}
+		sc, err := ln.Accept()
+		if err != nil {
+			c.Close()
+			t.Fatal(err)
+		}
+		v4 := host == "127.0.0.1"
+		for _, addr := range []net.Addr{c.LocalAddr(), c.RemoteAddr(), sc.RemoteAddr()} {
+			if ip := addr.(*net.TCPAddr).IP; (ip.To4() != nil) != v4 {
+				t.Errorf("dial %s: address %v in the wrong family", host, addr)
+			}
+		}
+		c.Close()
+		sc.Close()
+	}
+}
+
+// TestListenTCP6Only checks that a "tcp6" listener is IPv6 only.
+func TestListenTCP6Only(t *testing.T) {
+	loopbackInterface(t)
+	ln, err := ListenTCP("tcp6", "[::]:0", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	port := strconv.Itoa(ln.Addr().(*net.TCPAddr).Port)
+
+	if c, err := Dial(net.JoinHostPort("127.0.0.1", port), false, nil); err == nil {
+		c.Close()
+		t.Fatal("an IPv4 peer connected to a tcp6 listener")
+	}
+	c, err := DialTCP("tcp6", net.JoinHostPort("::1", port), false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+}